@@ -5,6 +5,7 @@ import (
 	"document-server/internal/config"
 	"document-server/pkg/logger"
 	"log"
+	"os"
 )
 
 func main() {
@@ -19,6 +20,13 @@ func main() {
 
 	defer logger.Sync()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(cfg.Database, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := app.Run(cfg); err != nil {
 		log.Fatal(err)
 	}
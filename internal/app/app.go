@@ -2,12 +2,17 @@ package app
 
 import (
 	"context"
+	"crypto/ed25519"
 	"document-server/internal/config"
 	"document-server/internal/domain/services"
 	"document-server/internal/infrastructure/cache"
 	"document-server/internal/infrastructure/database"
 	"document-server/internal/infrastructure/database/repositories"
+	"document-server/internal/infrastructure/metrics"
+	"document-server/internal/infrastructure/tracing"
 	"document-server/internal/interfaces/handlers"
+	"document-server/migrations"
+	"document-server/pkg/auditchain"
 	"document-server/pkg/logger"
 	"errors"
 	"net/http"
@@ -17,10 +22,24 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 )
 
 func Run(cfg config.Config) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error("Failed to set up tracing", zap.Error(err))
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Failed to flush traces", zap.Error(err))
+		}
+	}()
+
 	db, err := database.NewPostgresDB(cfg.Database)
 	if err != nil {
 		logger.Error("Failed to connect to database", zap.Error(err))
@@ -28,30 +47,174 @@ func Run(cfg config.Config) error {
 	}
 	defer db.Close()
 
-	redisClient, err := cache.NewRedisCache(cfg.Redis)
+	latestMigration, err := migrations.LatestVersion()
 	if err != nil {
-		logger.Error("Failed to connect to redis", zap.Error(err))
+		logger.Error("Failed to read embedded migrations", zap.Error(err))
 		return err
 	}
-	defer redisClient.Close()
+	if err := prepareSchema(context.Background(), cfg.Database, db, latestMigration); err != nil {
+		logger.Error("Failed to prepare database schema", zap.Error(err))
+		return err
+	}
+
+	appMetrics := metrics.New()
+	appMetrics.WatchPool(db.Pool())
+
+	// Redis is only a cache: when it is down the breaker fails its calls
+	// fast and the services read from Postgres until it is back.
+	var redisClient interface {
+		services.RedisClient
+		services.PubSubClient
+	}
+	var redisCache *cache.RedisCache
+	var breaker *cache.Breaker
+	if !cfg.Redis.Enabled() {
+		logger.Warn("Redis is not configured, caching in process; run a single replica only")
+		redisClient = cache.NewMemoryCache()
+	} else {
+		redisCache, err = cache.NewRedisCache(cfg.Redis)
+		if err != nil {
+			logger.Error("Invalid Redis configuration", zap.Error(err))
+			return err
+		}
+		defer redisCache.Close()
+
+		breaker = cache.NewBreaker(redisCache, cache.BreakerOptions{
+			Timeout:   cfg.Redis.Timeout,
+			Threshold: cfg.Redis.BreakerThreshold,
+			Cooldown:  cfg.Redis.BreakerCooldown,
+		})
+		if err := breaker.Probe(context.Background()); err != nil {
+			logger.Warn("Redis is unavailable, starting without cache", zap.Error(err))
+		}
+		redisClient = breaker
+		appMetrics.WatchBreaker(breaker)
+	}
 
 	userRepo := repositories.NewUserRepository(db.Pool())
 	docRepo := repositories.NewDocumentRepository(db.Pool())
 	sessionRepo := repositories.NewSessionRepository(db.Pool())
+	schemaRepo := repositories.NewSchemaRepository(db.Pool())
+	auditRepo := repositories.NewAuditRepository(db.Pool())
+	webhookRepo := repositories.NewWebhookRepository(db.Pool())
+	outboxRepo := repositories.NewOutboxRepository(db.Pool())
 
-	cacheSvc := services.NewRedisCacheService(redisClient, cfg.Auth.CacheDuration)
-	authSvc := services.NewAuthService(userRepo, sessionRepo, cfg.Auth.AdminToken, cfg.Auth.TokenDuration)
-	docSvc := services.NewDocumentService(docRepo, userRepo, cacheSvc)
+	var cacheSvc services.CacheService = services.NewRedisCacheService(redisClient, services.CacheTTLs{
+		Soft:     cfg.Cache.SoftTTL,
+		Hard:     cfg.Cache.HardTTL,
+		LoadLock: cfg.Cache.LoadLockTTL,
+		Session:  cfg.Cache.SessionTTL,
+		User:     cfg.Cache.UserTTL,
+	})
+	var tieredCache *services.TieredCacheService
+	if cfg.Cache.LocalSize > 0 {
+		tieredCache = services.NewTieredCacheService(cacheSvc, redisClient, services.TieredCacheOptions{
+			Size:          cfg.Cache.LocalSize,
+			TTL:           cfg.Cache.LocalTTL,
+			StatsInterval: cfg.Cache.StatsInterval,
+		})
+		cacheSvc = tieredCache
+		appMetrics.WatchTieredCache(tieredCache)
+	}
+	cacheSvc = appMetrics.InstrumentCache(cacheSvc)
+
+	var signingKey ed25519.PrivateKey
+	if cfg.Audit.SigningKey != "" {
+		signingKey, err = auditchain.ParsePrivateKey(cfg.Audit.SigningKey)
+		if err != nil {
+			logger.Error("Invalid audit signing key", zap.Error(err))
+			return err
+		}
+	}
+
+	auditSvc := services.NewAuditService(auditRepo, cfg.Audit.Retention, signingKey)
+	userResolver := services.NewUserResolver(userRepo, sessionRepo, cacheSvc)
+	authSvc := services.NewAuthService(userRepo, sessionRepo, userResolver, auditSvc, cfg.Auth.AdminToken, cfg.Auth.TokenDuration)
+	schemaSvc := services.NewSchemaService(schemaRepo)
+	webhookSvc := services.NewWebhookService(webhookRepo, services.WebhookOptions{
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		BackoffBase:  cfg.Webhooks.BackoffBase,
+		BackoffMax:   cfg.Webhooks.BackoffMax,
+		Timeout:      cfg.Webhooks.Timeout,
+		PollInterval: cfg.Webhooks.PollInterval,
+		BatchSize:    cfg.Webhooks.BatchSize,
+	})
+	eventSvc := services.NewEventService(redisClient, cfg.Events.BufferSize)
+	outboxSvc := services.NewOutboxService(outboxRepo, services.OutboxOptions{
+		PollInterval: cfg.Outbox.PollInterval,
+		BatchSize:    cfg.Outbox.BatchSize,
+		BackoffBase:  cfg.Outbox.BackoffBase,
+		BackoffMax:   cfg.Outbox.BackoffMax,
+	})
+	docSvc := services.NewDocumentService(docRepo, userResolver, cacheSvc, schemaSvc, auditSvc, webhookSvc, eventSvc, outboxSvc, cfg.Search.SimilarityThreshold, cfg.Search.SuggestLimit, cfg.Locks.DefaultTTL, cfg.Locks.MaxTTL)
 
 	authHandler := handlers.NewAuthHandler(authSvc)
-	docHandler := handlers.NewDocumentHandler(docSvc, authSvc, cfg.Storage.Path)
+	docHandler := handlers.NewDocumentHandler(docSvc, authSvc, cfg.Storage.Path, cfg.Server.RequireIfMatch, appMetrics)
+	schemaHandler := handlers.NewSchemaHandler(schemaSvc, authSvc)
+	auditHandler := handlers.NewAuditHandler(auditSvc, authSvc)
+	webhookHandler := handlers.NewWebhookHandler(webhookSvc, authSvc)
+	// Shutdown does not cancel the requests it waits for, so event streams
+	// are ended through this context.
+	streamsCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	eventHandler := handlers.NewEventHandler(streamsCtx, eventSvc, authSvc, cfg.Events.KeepAlive)
+
+	healthSvc := newHealthService(db, redisCache, breaker, cfg.Storage.Path, latestMigration)
+	healthHandler := handlers.NewHealthHandler(healthSvc, authSvc)
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	auditDone := make(chan struct{})
+	go func() {
+		defer close(auditDone)
+		auditSvc.RunWriter(bgCtx)
+	}()
+	go auditSvc.RunRetention(bgCtx, cfg.Audit.PurgeInterval)
+	go auditSvc.RunCheckpoints(bgCtx, cfg.Audit.CheckpointInterval)
+	go webhookSvc.RunDispatcher(bgCtx)
+	go eventSvc.Run(bgCtx)
+	if breaker != nil {
+		// Writes made while Redis was down could not invalidate it.
+		breaker.OnRecover(func(ctx context.Context) error {
+			return recoverCache(ctx, redisClient, cacheSvc)
+		})
+		go breaker.Run(bgCtx)
+	}
+	if tieredCache != nil {
+		go tieredCache.Run(bgCtx)
+	}
+	if cfg.Metrics.Enabled {
+		go appMetrics.RunStats(bgCtx, db.Pool(), cfg.Storage.Path, cfg.Metrics.StatsInterval)
+	}
+
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		outboxSvc.Run(bgCtx)
+	}()
 
 	r := gin.New()
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		switch req.URL.Path {
+		case cfg.Metrics.Path, "/healthz", "/readyz":
+			return false
+		}
+		return true
+	})))
+	// Logs after Recovery has answered a panic with 500.
+	r.Use(handlers.RequestLogMiddleware(cfg.Metrics.Path, "/healthz", "/readyz"))
 	r.Use(gin.Recovery())
+	r.Use(appMetrics.Middleware())
 	r.Use(handlers.HeadToGetMiddleware())
 	r.Use(handlers.CORSMiddleware())
+	r.Use(handlers.RequestMetaMiddleware())
 	r.HandleMethodNotAllowed = true
 
+	r.GET("/healthz", healthHandler.Live)
+	r.GET("/readyz", healthHandler.Ready)
+	r.GET("/status", healthHandler.Status)
+
 	api := r.Group("/api")
 	{
 		api.POST("/register", authHandler.Register)
@@ -61,15 +224,64 @@ func Run(cfg config.Config) error {
 		api.POST("/docs", docHandler.Create)
 		api.GET("/docs", docHandler.GetList)
 		api.HEAD("/docs", docHandler.GetList)
+		api.GET("/docs/suggest", docHandler.Suggest)
+		api.GET("/docs/aggregate", docHandler.Aggregate)
 		api.GET("/docs/:id", docHandler.GetByID)
 		api.HEAD("/docs/:id", docHandler.GetByID)
+		api.PUT("/docs/:id", docHandler.Update)
+		api.PATCH("/docs/:id", docHandler.Patch)
+		api.PUT("/docs/:id/grant", docHandler.UpdateAccess)
+		api.POST("/docs/:id/lock", docHandler.Lock)
+		api.PUT("/docs/:id/lock", docHandler.RefreshLock)
+		api.DELETE("/docs/:id/lock", docHandler.Unlock)
 		api.DELETE("/docs/:id", docHandler.Delete)
+		api.GET("/docs/:id/activity", docHandler.Activity)
+		api.GET("/changes", docHandler.Changes)
+
+		api.POST("/schemas", schemaHandler.Upsert)
+		api.GET("/schemas", schemaHandler.List)
+		api.GET("/schemas/:name", schemaHandler.GetByName)
+		api.DELETE("/schemas/:name", schemaHandler.Delete)
+
+		api.GET("/audit", auditHandler.List)
+
+		api.GET("/events", eventHandler.Stream)
+
+		api.POST("/webhooks", webhookHandler.Create)
+		api.GET("/webhooks", webhookHandler.List)
+		api.DELETE("/webhooks/:id", webhookHandler.Delete)
+		api.GET("/webhooks/:id/deliveries", webhookHandler.Deliveries)
+		api.POST("/webhooks/:id/deliveries/:delivery/replay", webhookHandler.Replay)
+	}
+
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Port == "" {
+			r.GET(cfg.Metrics.Path, healthHandler.Metrics(appMetrics.Handler()))
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle(cfg.Metrics.Path, appMetrics.Handler())
+			metricsSrv = &http.Server{
+				Addr:    ":" + cfg.Metrics.Port,
+				Handler: mux,
+			}
+		}
 	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
 		Handler: r,
 	}
+	srv.RegisterOnShutdown(stopStreams)
+
+	if metricsSrv != nil {
+		go func() {
+			logger.Info("Starting metrics server", zap.String("port", cfg.Metrics.Port))
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("Failed to listen metrics server", zap.Error(err))
+			}
+		}()
+	}
 
 	go func() {
 		logger.Info("Starting server", zap.String("port", cfg.Server.Port))
@@ -84,7 +296,27 @@ func Run(cfg config.Config) error {
 
 	logger.Info("Shutting down server...")
 
+	// Fail readiness first and give the load balancer time to notice, so
+	// no new requests are sent to a server about to stop accepting them.
+	healthSvc.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return srv.Shutdown(ctx)
+	err = srv.Shutdown(ctx)
+	if metricsSrv != nil {
+		// Keep serving metrics until the API is down, then stop.
+		metricsSrv.Shutdown(ctx)
+	}
+
+	// No request writes anymore; apply what the last ones queued.
+	stopBackground()
+	<-auditDone
+	<-relayDone
+	// The shutdown context may be spent waiting for requests.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelDrain()
+	outboxSvc.Drain(drainCtx)
+
+	return err
 }
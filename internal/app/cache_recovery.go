@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"document-server/internal/domain/services"
+	"document-server/pkg/logger"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// cacheRecoveryKey marks the wipe of the cache after a Redis outage, so
+	// that one replica scans the keyspace and the others wait for it.
+	// Replicas cannot tell one outage from the next, so recoveries within
+	// cacheRecoveryWindow of a wipe count as the same outage; writes made in
+	// a later one are still invalidated by the outbox.
+	cacheRecoveryKey     = "cache:recovery"
+	cacheRecoveryWindow  = 5 * time.Minute
+	cacheRecoveryTimeout = time.Minute
+
+	cacheRecoveryRunning = "running"
+	cacheRecoveryDone    = "done"
+)
+
+// cacheRecoveryPrefixes start the keys that writes made during an outage may
+// have left stale.
+var cacheRecoveryPrefixes = []string{"doc:{", "docs:{", "session:", "user:"}
+
+var errCacheRecoveryPending = errors.New("another replica is dropping the cache")
+
+// recoverCache drops the entries cached before a Redis outage, unless another
+// replica has done so for this outage. While another replica is at it, it
+// fails so the breaker tries again after its cooldown.
+func recoverCache(ctx context.Context, client services.RedisClient, cacheSvc services.CacheService) error {
+	ctx, cancel := context.WithTimeout(ctx, cacheRecoveryTimeout)
+	defer cancel()
+
+	claimed, err := client.SetNX(ctx, cacheRecoveryKey, cacheRecoveryRunning, cacheRecoveryTimeout)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		state, err := client.Get(ctx, cacheRecoveryKey)
+		switch {
+		case err == nil && state == cacheRecoveryDone:
+			logger.Info("Cache already dropped after Redis outage by another replica")
+			return nil
+		case err == nil, errors.Is(err, services.ErrCacheMiss):
+			return errCacheRecoveryPending
+		default:
+			return err
+		}
+	}
+
+	for _, prefix := range cacheRecoveryPrefixes {
+		if err := cacheSvc.InvalidatePrefix(ctx, prefix); err != nil {
+			logger.Error("Failed to drop cached entries after Redis outage",
+				zap.String("prefix", prefix),
+				zap.Error(err),
+			)
+			// Let the next replica to recover try again.
+			_ = client.Del(ctx, cacheRecoveryKey)
+			return err
+		}
+	}
+
+	return client.Set(ctx, cacheRecoveryKey, cacheRecoveryDone, cacheRecoveryWindow)
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"document-server/internal/domain/services"
+	"document-server/internal/infrastructure/cache"
+	"document-server/internal/infrastructure/database"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+func postgresCheck(db *database.PostgresDB) services.HealthCheck {
+	return services.HealthCheck{
+		Name: "postgres",
+		Check: func(ctx context.Context) error {
+			return db.Pool().Ping(ctx)
+		},
+	}
+}
+
+// redisCheck reports Redis down while the breaker is not closed, without
+// waiting for a ping. Without Redis the server only loses its cache.
+func redisCheck(redisCache *cache.RedisCache, breaker *cache.Breaker) services.HealthCheck {
+	return services.HealthCheck{
+		Name:     "redis",
+		Optional: true,
+		Check: func(ctx context.Context) error {
+			if state := breaker.State(); state != cache.BreakerClosed {
+				return fmt.Errorf("circuit breaker %s", state)
+			}
+			return redisCache.Ping(ctx)
+		},
+	}
+}
+
+// storageCheck creates and removes a file in the storage directory.
+func storageCheck(path string) services.HealthCheck {
+	return services.HealthCheck{
+		Name: "storage",
+		Check: func(ctx context.Context) error {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			file, err := os.CreateTemp(path, ".healthcheck-*")
+			if err != nil {
+				return err
+			}
+			file.Close()
+			return os.Remove(file.Name())
+		},
+	}
+}
+
+// migrationsCheck requires the schema to be at the newest embedded
+// migration: an older one lacks what this build queries.
+func migrationsCheck(db *database.PostgresDB, expected uint64) services.HealthCheck {
+	return services.HealthCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) error {
+			version, dirty, err := db.SchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if dirty {
+				return fmt.Errorf("migration %d failed halfway", version)
+			}
+			if version != expected {
+				return fmt.Errorf("schema at version %d, expected %d", version, expected)
+			}
+			return nil
+		},
+	}
+}
+
+// versionsFunc reports the build of this binary, the schema it expects and
+// finds, and the Postgres server version.
+func versionsFunc(db *database.PostgresDB, expected uint64) func(ctx context.Context) map[string]string {
+	build := map[string]string{
+		"go":     runtime.Version(),
+		"binary": filepath.Base(os.Args[0]),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build["module"] = info.Main.Version
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				build["revision"] = setting.Value
+			case "vcs.time":
+				build["revision_time"] = setting.Value
+			case "vcs.modified":
+				build["modified"] = setting.Value
+			}
+		}
+	}
+
+	return func(ctx context.Context) map[string]string {
+		versions := make(map[string]string, len(build)+3)
+		for key, value := range build {
+			versions[key] = value
+		}
+
+		versions["schema_expected"] = strconv.FormatUint(expected, 10)
+		if version, _, err := db.SchemaVersion(ctx); err == nil {
+			versions["schema"] = strconv.FormatUint(version, 10)
+		}
+		if version, err := db.ServerVersion(ctx); err == nil {
+			versions["postgres"] = version
+		}
+		return versions
+	}
+}
+
+// newHealthService checks Postgres, the schema, the storage directory and,
+// when configured, Redis.
+func newHealthService(db *database.PostgresDB, redisCache *cache.RedisCache, breaker *cache.Breaker, storagePath string, expected uint64) *services.HealthService {
+	checks := []services.HealthCheck{
+		postgresCheck(db),
+		migrationsCheck(db, expected),
+		storageCheck(storagePath),
+	}
+	if breaker != nil {
+		checks = append(checks, redisCheck(redisCache, breaker))
+	}
+
+	return services.NewHealthService(versionsFunc(db, expected), checks...)
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"document-server/internal/config"
+	"document-server/internal/infrastructure/database"
+	"document-server/pkg/logger"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const migrateUsage = "usage: server migrate up | down [N|all] | status | force VERSION"
+
+// Migrate runs the migrate subcommand:
+//
+//	up             apply every pending migration
+//	down [N]       revert the last N migrations, 1 by default
+//	down all       revert every migration
+//	status         show the applied and the newest version
+//	force VERSION  mark VERSION as applied after a failed migration
+func Migrate(cfg config.DatabaseConfig, args []string) error {
+	run, err := migrateCommand(args)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := database.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	if err := run(migrator); err != nil {
+		return err
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	printMigrationStatus(status)
+	return nil
+}
+
+// migrateCommand parses the arguments before anything connects to the
+// database.
+func migrateCommand(args []string) (func(m *database.Migrator) error, error) {
+	if len(args) == 0 {
+		return nil, errors.New(migrateUsage)
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		return (*database.Migrator).Up, nil
+	case args[0] == "down" && len(args) == 2 && args[1] == "all":
+		return (*database.Migrator).DownAll, nil
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return nil, fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		return func(m *database.Migrator) error {
+			return m.Down(steps)
+		}, nil
+	case args[0] == "force" && len(args) == 2:
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", args[1])
+		}
+		return func(m *database.Migrator) error {
+			return m.Force(version)
+		}, nil
+	case args[0] == "status" && len(args) == 1:
+		return func(*database.Migrator) error {
+			return nil
+		}, nil
+	default:
+		return nil, errors.New(migrateUsage)
+	}
+}
+
+func printMigrationStatus(status database.MigrationStatus) {
+	version := "none"
+	if status.Version != 0 {
+		version = strconv.FormatUint(status.Version, 10)
+	}
+	if status.Dirty {
+		version += " (dirty)"
+	}
+
+	fmt.Printf("version: %s\nlatest:  %d\npending: %d\n", version, status.Latest, status.Pending)
+	if status.Version > status.Latest {
+		fmt.Println("the schema is newer than this build")
+	}
+}
+
+// prepareSchema applies pending migrations when auto_migrate is on, then
+// refuses a schema newer than this build: its code may not work with it.
+// An older or dirty schema only keeps the server from being ready.
+func prepareSchema(ctx context.Context, cfg config.DatabaseConfig, db *database.PostgresDB, latest uint64) error {
+	if cfg.AutoMigrate {
+		migrator, err := database.NewMigrator(cfg)
+		if err != nil {
+			return err
+		}
+		err = migrator.Up()
+		migrator.Close()
+		if err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	}
+
+	version, dirty, err := db.SchemaVersion(ctx)
+	switch {
+	case errors.Is(err, database.ErrNoSchema):
+		logger.Warn("No migrations applied, run server migrate up")
+	case err != nil:
+		return err
+	case version > latest:
+		return fmt.Errorf("%w: schema at version %d, newest migration is %d", database.ErrSchemaNewer, version, latest)
+	case dirty:
+		logger.Warn("Migration failed halfway, repair it and run server migrate force",
+			zap.Uint64("version", version),
+		)
+	case version < latest:
+		logger.Warn("Schema is behind this build, run server migrate up",
+			zap.Uint64("version", version),
+			zap.Uint64("latest", latest),
+		)
+	default:
+		logger.Info("Schema is up to date", zap.Uint64("version", version))
+	}
+	return nil
+}
@@ -11,14 +11,27 @@ type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
 	Database DatabaseConfig `mapstructure:"database"`
 	Redis    RedisConfig    `mapstructure:"redis"`
+	Cache    CacheConfig    `mapstructure:"cache"`
 	Auth     AuthConfig     `mapstructrue:"auth"`
 	Storage  StorageConfig  `mapstructure:"storage"`
+	Search   SearchConfig   `mapstructure:"search"`
+	Locks    LocksConfig    `mapstructure:"locks"`
+	Audit    AuditConfig    `mapstructure:"audit"`
+	Webhooks WebhooksConfig `mapstructure:"webhooks"`
+	Events   EventsConfig   `mapstructure:"events"`
+	Outbox   OutboxConfig   `mapstructure:"outbox"`
+	Metrics  MetricsConfig  `mapstructure:"metrics"`
+	Tracing  TracingConfig  `mapstructure:"tracing"`
 }
 
 type ServerConfig struct {
-	Port         string        `mapstructure:"port"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	Port           string        `mapstructure:"port"`
+	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
+	RequireIfMatch bool          `mapstructure:"require_if_match"`
+	// DrainDelay is how long the server stays up unready before shutting
+	// down.
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
 }
 
 type DatabaseConfig struct {
@@ -28,18 +41,63 @@ type DatabaseConfig struct {
 	Password string `mapstructrue:"password"`
 	Database string `mapstructure:"database"`
 	SSLMode  string `mapstructure:"ssl_mode"`
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+	// MigrateLockTimeout bounds the wait for another replica that is
+	// migrating.
+	MigrateLockTimeout time.Duration `mapstructure:"migrate_lock_timeout"`
 }
 
 type RedisConfig struct {
-	Addr     string `mapstructure:"address"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
+	Addr string `mapstructure:"address"`
+	// Addrs are the sentinels when MasterName is set, and the seeds of a
+	// Cluster otherwise.
+	Addrs            []string       `mapstructure:"addresses"`
+	MasterName       string         `mapstructure:"master_name"`
+	Cluster          bool           `mapstructure:"cluster"`
+	Username         string         `mapstructure:"username"`
+	Password         string         `mapstructure:"password"`
+	SentinelUsername string         `mapstructure:"sentinel_username"`
+	SentinelPassword string         `mapstructure:"sentinel_password"`
+	DB               int            `mapstructure:"db"`
+	TLS              RedisTLSConfig `mapstructure:"tls"`
+	PoolSize         int            `mapstructure:"pool_size"`
+	MinIdleConns     int            `mapstructure:"min_idle_conns"`
+	PoolTimeout      time.Duration  `mapstructure:"pool_timeout"`
+	ConnMaxIdleTime  time.Duration  `mapstructure:"conn_max_idle_time"`
+	Timeout          time.Duration  `mapstructure:"timeout"`
+	BreakerThreshold int            `mapstructure:"breaker_threshold"`
+	BreakerCooldown  time.Duration  `mapstructure:"breaker_cooldown"`
+}
+
+// Enabled reports whether a Redis server is configured at all.
+func (c RedisConfig) Enabled() bool {
+	return c.Addr != "" || len(c.Addrs) > 0
+}
+
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	ServerName         string `mapstructure:"server_name"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+type CacheConfig struct {
+	SoftTTL       time.Duration `mapstructure:"soft_ttl"`
+	HardTTL       time.Duration `mapstructure:"hard_ttl"`
+	LoadLockTTL   time.Duration `mapstructure:"load_lock_ttl"`
+	SessionTTL    time.Duration `mapstructure:"session_ttl"`
+	UserTTL       time.Duration `mapstructure:"user_ttl"`
+	LocalSize     int           `mapstructure:"local_size"`
+	LocalTTL      time.Duration `mapstructure:"local_ttl"`
+	StatsInterval time.Duration `mapstructure:"stats_interval"`
 }
 
 type AuthConfig struct {
 	AdminToken    string        `mapstructure:"admin_token"`
 	TokenDuration time.Duration `mapstructure:"token_duration"`
-	CacheDuration time.Duration `mapstructure:"cache_duration"`
 }
 
 type StorageConfig struct {
@@ -48,6 +106,66 @@ type StorageConfig struct {
 	AllowedMimes []string `mapstructure:"allowed_mimes"`
 }
 
+type SearchConfig struct {
+	SimilarityThreshold float64 `mapstructure:"similarity_threshold"`
+	SuggestLimit        int     `mapstructure:"suggest_limit"`
+}
+
+type LocksConfig struct {
+	DefaultTTL time.Duration `mapstructure:"default_ttl"`
+	MaxTTL     time.Duration `mapstructure:"max_ttl"`
+}
+
+type AuditConfig struct {
+	Retention          time.Duration `mapstructure:"retention"`
+	PurgeInterval      time.Duration `mapstructure:"purge_interval"`
+	SigningKey         string        `mapstructure:"signing_key"`
+	VerifyKey          string        `mapstructure:"verify_key"`
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+}
+
+type WebhooksConfig struct {
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	BackoffBase  time.Duration `mapstructure:"backoff_base"`
+	BackoffMax   time.Duration `mapstructure:"backoff_max"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+}
+
+type EventsConfig struct {
+	BufferSize int           `mapstructure:"buffer_size"`
+	KeepAlive  time.Duration `mapstructure:"keep_alive"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	BackoffBase  time.Duration `mapstructure:"backoff_base"`
+	BackoffMax   time.Duration `mapstructure:"backoff_max"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	// Port serves the metrics on a listener of their own; empty serves them
+	// along with the API, to holders of the admin token only.
+	Port          string        `mapstructure:"port"`
+	StatsInterval time.Duration `mapstructure:"stats_interval"`
+}
+
+type TracingConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	ServiceName string `mapstructure:"service_name"`
+	// Endpoint is the host:port of the OTLP collector. Empty leaves it to
+	// the OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string `mapstructure:"endpoint"`
+	// Protocol is "grpc" or "http".
+	Protocol    string  `mapstructure:"protocol"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
 func Load() (Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -58,16 +176,59 @@ func Load() (Config, error) {
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.read_timeout", "10s")
 	viper.SetDefault("server.write_timeout", "10s")
+	viper.SetDefault("server.require_if_match", false)
+	viper.SetDefault("server.drain_delay", "0s")
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", 5432)
 	viper.SetDefault("database.ssl_mode", "disable")
+	viper.SetDefault("database.auto_migrate", false)
+	viper.SetDefault("database.migrate_lock_timeout", "5m")
 	viper.SetDefault("redis.address", "localhost:6379")
 	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.tls.enabled", false)
+	viper.SetDefault("redis.timeout", "500ms")
+	viper.SetDefault("redis.breaker_threshold", 5)
+	viper.SetDefault("redis.breaker_cooldown", "10s")
+	viper.SetDefault("cache.soft_ttl", "30m")
+	viper.SetDefault("cache.hard_ttl", "1h")
+	viper.SetDefault("cache.load_lock_ttl", "5s")
+	viper.SetDefault("cache.session_ttl", "30s")
+	viper.SetDefault("cache.user_ttl", "1m")
+	viper.SetDefault("cache.local_size", 10000)
+	viper.SetDefault("cache.local_ttl", "5s")
+	viper.SetDefault("cache.stats_interval", "5m")
 	viper.SetDefault("auth.admin_token", "admin_secret_token")
 	viper.SetDefault("auth.token_duration", "24h")
-	viper.SetDefault("auth.cache_duration", "1h")
 	viper.SetDefault("storage.path", "./uploads")
 	viper.SetDefault("storage.max_size", 10<<20) // 10MB
+	viper.SetDefault("search.similarity_threshold", 0.3)
+	viper.SetDefault("search.suggest_limit", 10)
+	viper.SetDefault("locks.default_ttl", "30m")
+	viper.SetDefault("locks.max_ttl", "8h")
+	viper.SetDefault("audit.retention", "8760h") // 1 год
+	viper.SetDefault("audit.purge_interval", "24h")
+	viper.SetDefault("audit.checkpoint_interval", "1h")
+	viper.SetDefault("webhooks.max_attempts", 8)
+	viper.SetDefault("webhooks.backoff_base", "30s")
+	viper.SetDefault("webhooks.backoff_max", "6h")
+	viper.SetDefault("webhooks.timeout", "10s")
+	viper.SetDefault("webhooks.poll_interval", "5s")
+	viper.SetDefault("webhooks.batch_size", 20)
+	viper.SetDefault("events.buffer_size", 1000)
+	viper.SetDefault("events.keep_alive", "15s")
+	viper.SetDefault("outbox.poll_interval", "1s")
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.backoff_base", "1s")
+	viper.SetDefault("outbox.backoff_max", "5m")
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.port", "9090")
+	viper.SetDefault("metrics.stats_interval", "1m")
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.service_name", "document-server")
+	viper.SetDefault("tracing.protocol", "grpc")
+	viper.SetDefault("tracing.insecure", false)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return Config{}, err
@@ -0,0 +1,34 @@
+package entities
+
+import "document-server/pkg/jsonpatch"
+
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+
+	GroupByJSON      = "json"
+	GroupByMIME      = "mime"
+	GroupByOwner     = "owner"
+	GroupByCreatedAt = "created_at"
+)
+
+// AggregateQuery groups the documents matched by Filter and visible to
+// Filter.RequestingUserLogin, computing Metric over the numeric JSON value at
+// Field (not used for count).
+type AggregateQuery struct {
+	Filter    DocumentFilter
+	GroupBy   string
+	GroupPath jsonpatch.Pointer
+	Bucket    string
+	Metric    string
+	Field     jsonpatch.Pointer
+}
+
+type AggregateBucket struct {
+	Key   *string  `json:"key"`
+	Count int64    `json:"count"`
+	Value *float64 `json:"value"`
+}
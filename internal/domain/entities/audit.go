@@ -0,0 +1,91 @@
+package entities
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	AuditActionDocumentView     = "document.view"
+	AuditActionDocumentDownload = "document.download"
+	AuditActionDocumentCreate   = "document.create"
+	AuditActionDocumentUpdate   = "document.update"
+	AuditActionDocumentShare    = "document.share"
+	AuditActionDocumentDelete   = "document.delete"
+	AuditActionDocumentLock     = "document.lock"
+	AuditActionDocumentUnlock   = "document.unlock"
+	AuditActionRegister         = "auth.register"
+	AuditActionLogin            = "auth.login"
+	AuditActionLogout           = "auth.logout"
+
+	AuditTargetDocument = "document"
+	AuditTargetUser     = "user"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records one action taken by Actor (a user login, empty when
+// unknown) on a target.
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// PrevHash and Hash link the event into the audit hash chain. Events
+	// written before the chain existed have neither.
+	PrevHash []byte `json:"prev_hash,omitempty"`
+	Hash     []byte `json:"hash,omitempty"`
+}
+
+// ChainFields returns the values covered by the event's chain hash.
+func (e *AuditEvent) ChainFields() []string {
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Actor, e.Action, e.TargetType, e.TargetID,
+		e.IP, e.UserAgent, e.Outcome, e.Detail,
+	}
+}
+
+// AuditCheckpoint is a signed statement that the event EventID had Hash.
+type AuditCheckpoint struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"event_id"`
+	Hash      []byte    `json:"hash"`
+	Signature []byte    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditVerification is the result of walking the audit hash chain.
+// BrokenAt is the ID of the first event (or checkpoint, see Reason) that
+// fails verification, zero when the chain is intact.
+type AuditVerification struct {
+	Events      int64  `json:"events"`
+	Unchained   int64  `json:"unchained"`
+	Checkpoints int64  `json:"checkpoints"`
+	FirstID     int64  `json:"first_id"`
+	LastID      int64  `json:"last_id"`
+	BrokenAt    int64  `json:"broken_at,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
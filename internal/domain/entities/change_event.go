@@ -0,0 +1,48 @@
+package entities
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	ChangeEventCreated = "created"
+	ChangeEventUpdated = "updated"
+	ChangeEventDeleted = "deleted"
+	ChangeEventGrant   = "grant"
+)
+
+// ChangeEvent is a document change streamed to the users who can see the
+// document.
+type ChangeEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	Actor     string           `json:"actor"`
+	CreatedAt time.Time        `json:"created_at"`
+	Document  *DocumentSummary `json:"document"`
+	Grant     []string         `json:"grant,omitempty"`
+}
+
+// DocumentAccess is who could read a document at some point: the owner, the
+// grantees and, for public documents, everyone.
+type DocumentAccess struct {
+	OwnerID string   `json:"owner_id"`
+	Public  bool     `json:"public"`
+	Grant   []string `json:"grant,omitempty"`
+}
+
+func NewDocumentAccess(doc *Document) DocumentAccess {
+	access := DocumentAccess{
+		OwnerID: doc.OwnerID,
+		Public:  doc.IsPublic,
+	}
+	if doc.Grant != nil {
+		access.Grant = *doc.Grant
+	}
+	return access
+}
+
+// Allows applies the document access rules to user.
+func (a DocumentAccess) Allows(user *User) bool {
+	return a.Public || a.OwnerID == user.ID || slices.Contains(a.Grant, user.Login)
+}
@@ -1,7 +1,9 @@
 package entities
 
 import (
+	"document-server/pkg/jsonpatch"
 	"encoding/json"
+	"slices"
 	"time"
 )
 
@@ -15,14 +17,129 @@ type Document struct {
 	FilePath  *string          `json:"file_path,omitempty"`
 	JSONData  *json.RawMessage `json:"json,omitempty"`
 	Grant     *[]string        `json:"grant"`
+	SchemaID  *string          `json:"schema_id,omitempty"`
+	Version   int64            `json:"version"`
+	Lock      *DocumentLock    `json:"lock,omitempty"`
 	CreatedAt time.Time        `json:"created_at"`
 	UpdatedAt time.Time        `json:"updated_at"`
 }
 
+// DocumentSummary is the part of a document included in event payloads.
+type DocumentSummary struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	OwnerID  string `json:"owner_id"`
+	MIME     string `json:"mime"`
+	IsFile   bool   `json:"file"`
+	IsPublic bool   `json:"public"`
+	Version  int64  `json:"version"`
+}
+
+func NewDocumentSummary(doc *Document) *DocumentSummary {
+	return &DocumentSummary{
+		ID:       doc.ID,
+		Name:     doc.Name,
+		OwnerID:  doc.OwnerID,
+		MIME:     doc.MIME,
+		IsFile:   doc.IsFile,
+		IsPublic: doc.IsPublic,
+		Version:  doc.Version,
+	}
+}
+
+// Clone returns a copy of d that shares no memory with it.
+func (d *Document) Clone() *Document {
+	clone := *d
+	if d.FilePath != nil {
+		filePath := *d.FilePath
+		clone.FilePath = &filePath
+	}
+	if d.JSONData != nil {
+		data := slices.Clone(*d.JSONData)
+		clone.JSONData = &data
+	}
+	if d.Grant != nil {
+		grant := slices.Clone(*d.Grant)
+		clone.Grant = &grant
+	}
+	if d.SchemaID != nil {
+		schemaID := *d.SchemaID
+		clone.SchemaID = &schemaID
+	}
+	if d.Lock != nil {
+		lock := *d.Lock
+		clone.Lock = &lock
+	}
+	return &clone
+}
+
+// DocumentLock is a check-out lease: until ExpiresAt only Holder may write.
+type DocumentLock struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ActiveLock returns the lock if it has not expired at now.
+func (d *Document) ActiveLock(now time.Time) *DocumentLock {
+	if d.Lock == nil || !d.Lock.ExpiresAt.After(now) {
+		return nil
+	}
+	return d.Lock
+}
+
+// VersionMatch is the set of document versions an If-Match precondition
+// accepts. A nil VersionMatch accepts any version; an empty one none.
+type VersionMatch []int64
+
+func (m VersionMatch) Matches(version int64) bool {
+	return m == nil || slices.Contains(m, version)
+}
+
+// WriteCondition guards a document write. The write only happens if the
+// document is still at ExpectedVersion (zero skips the check) and is not
+// locked by anyone but Actor.
+type WriteCondition struct {
+	ExpectedVersion int64
+	Actor           string
+}
+
+const (
+	SearchModeExact   = ""
+	SearchModeSimilar = "similar"
+)
+
 type DocumentFilter struct {
 	OwnerID             string
 	RequestingUserLogin string
 	Key                 string
 	Value               string
-	Limit               int
+	Mode                string
+	// Threshold is the similarity threshold of SearchModeSimilar; nil means
+	// the configured default.
+	Threshold *float64
+	Fields    []jsonpatch.Pointer
+	Limit     int
+}
+
+// JSONProjection selects part of a document's JSON body: either the single
+// value at Pointer, or an object holding only Fields.
+type JSONProjection struct {
+	Pointer jsonpatch.Pointer
+	Fields  []jsonpatch.Pointer
+}
+
+func (p *JSONProjection) Paths() []jsonpatch.Pointer {
+	if p.Pointer != nil {
+		return []jsonpatch.Pointer{p.Pointer}
+	}
+	return p.Fields
+}
+
+type SuggestFilter struct {
+	UserID    string
+	UserLogin string
+	Query     string
+	Threshold float64
+	Limit     int
 }
@@ -0,0 +1,44 @@
+package entities
+
+import "time"
+
+const (
+	DocumentChangeUpsert = "upsert"
+	DocumentChangeDelete = "delete"
+
+	ChangeKindUpsert    = "upsert"
+	ChangeKindTombstone = "tombstone"
+
+	TombstoneDeleted = "deleted"
+	TombstoneRevoked = "revoked"
+)
+
+// DocumentChange is an entry of the change log: the document as the change
+// left it, with its access before and after.
+type DocumentChange struct {
+	Seq        int64
+	Op         string
+	Document   *DocumentSummary
+	Access     DocumentAccess
+	PrevAccess DocumentAccess
+	ChangedAt  time.Time
+}
+
+// ChangeFeedEntry is a change as one user sees it. A tombstone tells the
+// client to drop its copy, because the document was deleted or the user
+// lost access to it.
+type ChangeFeedEntry struct {
+	Kind      string           `json:"kind"`
+	Reason    string           `json:"reason,omitempty"`
+	Document  *DocumentSummary `json:"document"`
+	Grant     []string         `json:"grant,omitempty"`
+	ChangedAt time.Time        `json:"changed_at"`
+}
+
+// ChangeFeedPage is a page of the change feed. Next is the sync token to
+// continue from.
+type ChangeFeedPage struct {
+	Changes []*ChangeFeedEntry `json:"changes"`
+	Next    string             `json:"next"`
+	HasMore bool               `json:"has_more"`
+}
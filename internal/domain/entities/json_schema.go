@@ -0,0 +1,16 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JSONSchema struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	OwnerID   string          `json:"owner_id"`
+	Schema    json.RawMessage `json:"schema"`
+	Patterns  []string        `json:"patterns"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
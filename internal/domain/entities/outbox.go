@@ -0,0 +1,37 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxKindDocumentMutation = "document.mutation"
+
+	MutationCreated = "created"
+	MutationUpdated = "updated"
+	MutationAccess  = "access"
+	MutationDeleted = "deleted"
+)
+
+// OutboxMessage is a side effect queued in the transaction of the write that
+// caused it. It is applied at least once.
+type OutboxMessage struct {
+	ID            int64
+	Kind          string
+	Payload       json.RawMessage
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     *string
+	CreatedAt     time.Time
+}
+
+// DocumentMutation describes a committed document write. Actor is empty for
+// creations, which are made by the owner.
+type DocumentMutation struct {
+	Op         string           `json:"op"`
+	Actor      string           `json:"actor"`
+	Document   *DocumentSummary `json:"document"`
+	Access     DocumentAccess   `json:"access"`
+	PrevAccess DocumentAccess   `json:"prev_access"`
+}
@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhookEventDocumentCreated    = "document.created"
+	WebhookEventDocumentUpdated    = "document.updated"
+	WebhookEventDocumentDeleted    = "document.deleted"
+	WebhookEventDocumentShared     = "document.shared"
+	WebhookEventDocumentUnshared   = "document.unshared"
+	WebhookEventDocumentDownloaded = "document.downloaded"
+
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+// WebhookEventTypes lists the events a webhook can subscribe to.
+var WebhookEventTypes = []string{
+	WebhookEventDocumentCreated,
+	WebhookEventDocumentUpdated,
+	WebhookEventDocumentDeleted,
+	WebhookEventDocumentShared,
+	WebhookEventDocumentUnshared,
+	WebhookEventDocumentDownloaded,
+}
+
+// Webhook is an endpoint subscribed to document events. A webhook without an
+// owner was registered by an administrator and receives events for every
+// document; otherwise only for documents of its owner. No events means all
+// events.
+type Webhook struct {
+	ID        string    `json:"id"`
+	OwnerID   *string   `json:"owner_id,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is the payload posted to webhook endpoints.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	Actor     string           `json:"actor"`
+	CreatedAt time.Time        `json:"created_at"`
+	Document  *DocumentSummary `json:"document"`
+	Logins    []string         `json:"logins,omitempty"`
+	Public    *bool            `json:"public,omitempty"`
+}
+
+// WebhookDelivery is one event queued for one webhook, kept as the delivery
+// log once it is delivered or dead.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// Webhook is set on deliveries claimed for sending.
+	Webhook *Webhook `json:"-"`
+}
@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"time"
+)
+
+type AuditRepository interface {
+	// Create appends event to the hash chain, setting its ID, CreatedAt,
+	// PrevHash and Hash.
+	Create(ctx context.Context, event *entities.AuditEvent) error
+	// CreateBatch appends events in order, chaining them in one transaction.
+	CreateBatch(ctx context.Context, events []*entities.AuditEvent) error
+	List(ctx context.Context, filter *entities.AuditFilter) ([]*entities.AuditEvent, error)
+	// DeleteOlderThan drops events older than age, and never those younger
+	// than the calendar year the table itself protects.
+	DeleteOlderThan(ctx context.Context, age time.Duration) (int64, error)
+	// Walk calls fn for every event in chain order, stopping at the first
+	// error.
+	Walk(ctx context.Context, fn func(event *entities.AuditEvent) error) error
+	LatestEvent(ctx context.Context) (*entities.AuditEvent, error)
+
+	CreateCheckpoint(ctx context.Context, checkpoint *entities.AuditCheckpoint) error
+	LatestCheckpoint(ctx context.Context) (*entities.AuditCheckpoint, error)
+	ListCheckpoints(ctx context.Context) ([]*entities.AuditCheckpoint, error)
+}
@@ -3,11 +3,29 @@ package repositories
 import (
 	"context"
 	"document-server/internal/domain/entities"
+	"encoding/json"
+	"time"
 )
 
 type DocumentRepository interface {
 	Create(ctx context.Context, doc *entities.Document) error
 	GetByID(ctx context.Context, id string) (*entities.Document, error)
+	GetByIDProjected(ctx context.Context, id string, projection *entities.JSONProjection) (*entities.Document, error)
 	GetByOwner(ctx context.Context, filter *entities.DocumentFilter) ([]*entities.Document, error)
-	Delete(ctx context.Context, id string) error
+	SuggestNames(ctx context.Context, filter *entities.SuggestFilter) ([]string, error)
+	Aggregate(ctx context.Context, query *entities.AggregateQuery) ([]*entities.AggregateBucket, error)
+	// Write methods only modify the document if cond still holds, checked
+	// atomically with the write.
+	UpdateJSON(ctx context.Context, id string, data *json.RawMessage, cond entities.WriteCondition) (*entities.Document, error)
+	UpdateContent(ctx context.Context, doc *entities.Document, cond entities.WriteCondition) error
+	UpdateAccess(ctx context.Context, id string, isPublic bool, grant []string, cond entities.WriteCondition) (*entities.Document, error)
+	Delete(ctx context.Context, id string, cond entities.WriteCondition) error
+
+	// ListChanges returns the change log entries after since that concern
+	// documents the user can or could see, oldest first.
+	ListChanges(ctx context.Context, userID, userLogin string, since int64, limit int) ([]*entities.DocumentChange, error)
+
+	AcquireLock(ctx context.Context, id, holder string, ttl time.Duration) (*entities.Document, error)
+	RefreshLock(ctx context.Context, id, holder string, ttl time.Duration) (*entities.Document, error)
+	ReleaseLock(ctx context.Context, id, holder string, force bool) (*entities.Document, error)
 }
@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"time"
+)
+
+// OutboxRepository reads the outbox. Messages are written by the
+// repositories whose writes cause them, in the same transaction.
+type OutboxRepository interface {
+	// Claim takes up to limit due messages, oldest first, and pushes their
+	// next attempt lease into the future so concurrent relays skip them.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*entities.OutboxMessage, error)
+	Complete(ctx context.Context, id int64) error
+	// Fail records a failed attempt and schedules the next one retryIn from
+	// now by the database clock.
+	Fail(ctx context.Context, id int64, retryIn time.Duration, lastError string) error
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+)
+
+type SchemaRepository interface {
+	Upsert(ctx context.Context, schema *entities.JSONSchema) error
+	GetByID(ctx context.Context, id string) (*entities.JSONSchema, error)
+	GetByName(ctx context.Context, ownerID, name string) (*entities.JSONSchema, error)
+	ListByOwner(ctx context.Context, ownerID string) ([]*entities.JSONSchema, error)
+	Delete(ctx context.Context, ownerID, name string) error
+}
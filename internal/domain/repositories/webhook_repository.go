@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"time"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *entities.Webhook) error
+	// List returns the webhooks of ownerID, or the administrators' webhooks
+	// when ownerID is nil.
+	List(ctx context.Context, ownerID *string) ([]*entities.Webhook, error)
+	GetByID(ctx context.Context, id string) (*entities.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	// Subscribers returns the active webhooks that should receive eventType
+	// for a document owned by docOwnerID.
+	Subscribers(ctx context.Context, eventType, docOwnerID string) ([]*entities.Webhook, error)
+
+	// EnqueueDeliveries skips deliveries of events a webhook already has.
+	EnqueueDeliveries(ctx context.Context, deliveries []*entities.WebhookDelivery) error
+	// ClaimDueDeliveries takes up to limit pending deliveries that are due and
+	// pushes their next attempt lease into the future, so concurrent
+	// dispatchers do not send them twice.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*entities.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id string, statusCode int) error
+	// MarkFailed records a failed attempt and schedules the next one retryIn
+	// from now by the database clock.
+	MarkFailed(ctx context.Context, id string, status string, retryIn time.Duration, statusCode *int, lastError string) error
+	ListDeliveries(ctx context.Context, webhookID string, status string, limit, offset int) ([]*entities.WebhookDelivery, error)
+	// ReplayDelivery queues a delivery of webhookID again from scratch.
+	ReplayDelivery(ctx context.Context, webhookID, deliveryID string) (*entities.WebhookDelivery, error)
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/pkg/auditchain"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	stdErrors "errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// minAuditRetention is the compliance floor. The audit_events table
+	// refuses to drop rows younger than a calendar year, which the purge
+	// honours as well when the year has 366 days.
+	minAuditRetention = 365 * 24 * time.Hour
+
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+
+	// auditQueueSize bounds the events waiting for the background writer;
+	// auditBatchSize bounds those it chains under one hold of the lock.
+	auditQueueSize = 1024
+	auditBatchSize = 100
+)
+
+var errChainBroken = stdErrors.New("audit chain broken")
+
+type requestMetaKey struct{}
+
+// RequestMeta describes the client a request came from.
+type RequestMeta struct {
+	IP        string
+	UserAgent string
+}
+
+// WithRequestMeta attaches client details to ctx for the audit log.
+func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+func requestMetaFrom(ctx context.Context) RequestMeta {
+	meta, _ := ctx.Value(requestMetaKey{}).(RequestMeta)
+	return meta
+}
+
+type AuditService struct {
+	auditRepo  repositories.AuditRepository
+	retention  time.Duration
+	signingKey ed25519.PrivateKey
+	queue      chan *entities.AuditEvent
+	logger     *zap.Logger
+}
+
+// NewAuditService creates the audit service. Without a signing key no
+// checkpoints are written.
+func NewAuditService(auditRepo repositories.AuditRepository, retention time.Duration, signingKey ed25519.PrivateKey) *AuditService {
+	s := &AuditService{
+		auditRepo:  auditRepo,
+		retention:  retention,
+		signingKey: signingKey,
+		queue:      make(chan *entities.AuditEvent, auditQueueSize),
+		logger:     logger.Logger,
+	}
+
+	if s.retention < minAuditRetention {
+		s.logger.Warn("Audit retention below the compliance minimum, using the minimum",
+			zap.Duration("configured", retention),
+			zap.Duration("minimum", minAuditRetention),
+		)
+		s.retention = minAuditRetention
+	}
+
+	return s
+}
+
+// Record appends an event, filling in the client details from ctx. Failures
+// are logged and never fail the audited operation.
+func (s *AuditService) Record(ctx context.Context, event *entities.AuditEvent) {
+	meta := requestMetaFrom(ctx)
+	event.IP = meta.IP
+	event.UserAgent = meta.UserAgent
+
+	// The event is written even if the request was cancelled meanwhile.
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.auditRepo.Create(recordCtx, event); err != nil {
+		s.logger.Error("Failed to record audit event",
+			zap.String("actor", event.Actor),
+			zap.String("action", event.Action),
+			zap.String("target_id", event.TargetID),
+			zap.String("outcome", event.Outcome),
+			zap.Error(err),
+		)
+	}
+}
+
+// RecordAsync queues an event for RunWriter, keeping the chain lock off the
+// request path. Reads use it: they are by far the most frequent events. When
+// the queue is full the event is written right away rather than lost.
+func (s *AuditService) RecordAsync(ctx context.Context, event *entities.AuditEvent) {
+	meta := requestMetaFrom(ctx)
+	event.IP = meta.IP
+	event.UserAgent = meta.UserAgent
+
+	select {
+	case s.queue <- event:
+	default:
+		s.Record(ctx, event)
+	}
+}
+
+// RecordResult records the outcome of an operation that returned err.
+// Authorization failures are recorded as denied, other errors as failures.
+func (s *AuditService) RecordResult(ctx context.Context, actor, action, targetType, targetID string, err error) {
+	s.Record(ctx, resultEvent(actor, action, targetType, targetID, err))
+}
+
+// RecordResultAsync is RecordResult through the queue of RecordAsync.
+func (s *AuditService) RecordResultAsync(ctx context.Context, actor, action, targetType, targetID string, err error) {
+	s.RecordAsync(ctx, resultEvent(actor, action, targetType, targetID, err))
+}
+
+func resultEvent(actor, action, targetType, targetID string, err error) *entities.AuditEvent {
+	event := &entities.AuditEvent{
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Outcome:    entities.AuditOutcomeSuccess,
+	}
+
+	if err != nil {
+		event.Outcome = entities.AuditOutcomeFailure
+		switch err.(type) {
+		case *errors.UnauthorizedError, *errors.ForbiddenError, *errors.LockedError:
+			event.Outcome = entities.AuditOutcomeDenied
+		}
+		event.Detail = err.Error()
+	}
+
+	return event
+}
+
+// RunWriter writes queued events in batches until ctx is done, then writes
+// what is still queued.
+func (s *AuditService) RunWriter(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for len(s.queue) > 0 {
+				s.writeBatch(ctx, <-s.queue)
+			}
+			return
+		case event := <-s.queue:
+			s.writeBatch(ctx, event)
+		}
+	}
+}
+
+// writeBatch writes first and whatever else is queued, up to a batch.
+func (s *AuditService) writeBatch(ctx context.Context, first *entities.AuditEvent) {
+	batch := []*entities.AuditEvent{first}
+	for len(batch) < auditBatchSize && len(s.queue) > 0 {
+		batch = append(batch, <-s.queue)
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.auditRepo.CreateBatch(writeCtx, batch); err != nil {
+		s.logger.Error("Failed to record queued audit events",
+			zap.Int("events", len(batch)),
+			zap.String("first_action", first.Action),
+			zap.String("first_target_id", first.TargetID),
+			zap.Error(err),
+		)
+	}
+}
+
+func (s *AuditService) List(ctx context.Context, filter *entities.AuditFilter) ([]*entities.AuditEvent, error) {
+	s.logger.Debug("Listing audit events",
+		zap.Any("filter", filter),
+	)
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	if filter.Offset < 0 {
+		return nil, errors.NewBadRequestError("offset must not be negative")
+	}
+
+	switch filter.Outcome {
+	case "", entities.AuditOutcomeSuccess, entities.AuditOutcomeDenied, entities.AuditOutcomeFailure:
+	default:
+		return nil, errors.NewBadRequestError("unknown outcome")
+	}
+
+	events, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		s.logger.Error("Failed to list audit events",
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to list audit events")
+	}
+
+	if events == nil {
+		events = []*entities.AuditEvent{}
+	}
+
+	return events, nil
+}
+
+// Purge drops events older than the retention period.
+func (s *AuditService) Purge(ctx context.Context) (int64, error) {
+	return s.auditRepo.DeleteOlderThan(ctx, s.retention)
+}
+
+// RunRetention purges expired events every interval until ctx is done.
+func (s *AuditService) RunRetention(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.Purge(ctx)
+		if err != nil {
+			s.logger.Error("Failed to purge audit events",
+				zap.Duration("retention", s.retention),
+				zap.Error(err),
+			)
+		} else {
+			s.logger.Info("Audit events purged",
+				zap.Duration("retention", s.retention),
+				zap.Int64("deleted", deleted),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Checkpoint signs the current head of the hash chain unless it is already
+// covered by the latest checkpoint.
+func (s *AuditService) Checkpoint(ctx context.Context) (*entities.AuditCheckpoint, error) {
+	if s.signingKey == nil {
+		return nil, errors.NewBadRequestError("no audit signing key configured")
+	}
+
+	head, err := s.auditRepo.LatestEvent(ctx)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get audit chain head: %w", err)
+	}
+
+	if head.Hash == nil {
+		return nil, nil
+	}
+
+	latest, err := s.auditRepo.LatestCheckpoint(ctx)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); !ok {
+			return nil, fmt.Errorf("get latest audit checkpoint: %w", err)
+		}
+	} else if latest.EventID >= head.ID {
+		return latest, nil
+	}
+
+	checkpoint := &entities.AuditCheckpoint{
+		EventID:   head.ID,
+		Hash:      head.Hash,
+		Signature: auditchain.Sign(s.signingKey, head.ID, head.Hash),
+	}
+
+	if err := s.auditRepo.CreateCheckpoint(ctx, checkpoint); err != nil {
+		return nil, fmt.Errorf("store audit checkpoint for event %d: %w", head.ID, err)
+	}
+
+	s.logger.Info("Audit checkpoint signed",
+		zap.Int64("event_id", head.ID),
+		zap.Int64("checkpoint_id", checkpoint.ID),
+	)
+
+	return checkpoint, nil
+}
+
+// RunCheckpoints signs a checkpoint every interval until ctx is done.
+func (s *AuditService) RunCheckpoints(ctx context.Context, interval time.Duration) {
+	if s.signingKey == nil {
+		s.logger.Warn("No audit signing key configured, checkpoints are disabled")
+		return
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Checkpoint(ctx); err != nil {
+				s.logger.Error("Failed to sign audit checkpoint",
+					zap.Error(err),
+				)
+			}
+		}
+	}
+}
+
+// Verify walks the hash chain from the oldest retained event and checks every
+// link and every checkpoint signature against publicKey. It stops at the
+// first broken link. Events from before the chain existed are counted as
+// unchained; events purged by retention are not reported, but the chain must
+// be unbroken from the first retained event on.
+func (s *AuditService) Verify(ctx context.Context, publicKey ed25519.PublicKey) (*entities.AuditVerification, error) {
+	checkpoints, err := s.auditRepo.ListCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byEvent := make(map[int64][]*entities.AuditCheckpoint)
+	for _, checkpoint := range checkpoints {
+		byEvent[checkpoint.EventID] = append(byEvent[checkpoint.EventID], checkpoint)
+	}
+
+	result := &entities.AuditVerification{}
+	var prevHash []byte
+	chained := false
+
+	broken := func(id int64, reason string) error {
+		result.BrokenAt = id
+		result.Reason = reason
+		return errChainBroken
+	}
+
+	err = s.auditRepo.Walk(ctx, func(event *entities.AuditEvent) error {
+		if result.FirstID == 0 {
+			result.FirstID = event.ID
+		}
+		result.LastID = event.ID
+		result.Events++
+
+		if event.Hash == nil {
+			if chained {
+				return broken(event.ID, "event has no hash")
+			}
+			result.Unchained++
+			return nil
+		}
+
+		if chained && !bytes.Equal(event.PrevHash, prevHash) {
+			return broken(event.ID, "previous hash does not match the preceding event")
+		}
+		chained = true
+
+		if !auditchain.Valid(event.PrevHash, event.Hash, event.ChainFields()...) {
+			return broken(event.ID, "event content does not match its hash")
+		}
+
+		for _, checkpoint := range byEvent[event.ID] {
+			if !bytes.Equal(checkpoint.Hash, event.Hash) {
+				return broken(event.ID, fmt.Sprintf("checkpoint %d does not match the event hash", checkpoint.ID))
+			}
+			if !auditchain.VerifyCheckpoint(publicKey, checkpoint.EventID, checkpoint.Hash, checkpoint.Signature) {
+				return broken(event.ID, fmt.Sprintf("checkpoint %d has an invalid signature", checkpoint.ID))
+			}
+			result.Checkpoints++
+		}
+		delete(byEvent, event.ID)
+
+		prevHash = event.Hash
+		return nil
+	})
+	if err != nil && err != errChainBroken {
+		return nil, err
+	}
+	if result.BrokenAt != 0 {
+		return result, nil
+	}
+
+	// Checkpoints left over point at events that are gone. Those before the
+	// first retained event were purged; any later one means events were
+	// removed.
+	for eventID, pending := range byEvent {
+		if eventID < result.FirstID {
+			continue
+		}
+		if result.BrokenAt == 0 || eventID < result.BrokenAt {
+			result.BrokenAt = eventID
+			result.Reason = fmt.Sprintf("checkpoint %d refers to a missing event", pending[0].ID)
+		}
+	}
+
+	return result, nil
+}
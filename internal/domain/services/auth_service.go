@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"crypto/subtle"
 	"document-server/internal/domain/entities"
 	"document-server/internal/domain/repositories"
 	"document-server/internal/utils"
@@ -16,40 +17,57 @@ import (
 type AuthService struct {
 	userRepo      repositories.UserRepository
 	sessionRepo   repositories.SessionRepository
+	users         *UserResolver
+	audit         *AuditService
 	adminToken    string
 	tokenDuration time.Duration
-	logger        *zap.Logger
 }
 
 func NewAuthService(
 	userRepo repositories.UserRepository,
 	sessionRepo repositories.SessionRepository,
+	users *UserResolver,
+	audit *AuditService,
 	adminToken string,
 	tokenDuration time.Duration,
 ) *AuthService {
 	return &AuthService{
 		userRepo:      userRepo,
 		sessionRepo:   sessionRepo,
+		users:         users,
+		audit:         audit,
 		adminToken:    adminToken,
 		tokenDuration: tokenDuration,
-		logger:        logger.Logger,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, adminToken, login, password string) (*entities.User, error) {
-	s.logger.Debug("User registration attempt",
+// Register creates a user. The actor of the audit event is unknown: whoever
+// holds the admin token.
+func (s *AuthService) Register(ctx context.Context, adminToken, login, password string) (_ *entities.User, err error) {
+	ctx, span := startSpan(ctx, "AuthService.Register")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.register(ctx, adminToken, login, password)
+	s.audit.RecordResult(ctx, "", entities.AuditActionRegister, entities.AuditTargetUser, login, err)
+	return user, err
+}
+
+func (s *AuthService) register(ctx context.Context, adminToken, login, password string) (*entities.User, error) {
+	log := logger.FromContext(ctx)
+
+	log.Debug("User registration attempt",
 		zap.String("login", login),
 	)
 
 	if adminToken != s.adminToken {
-		s.logger.Warn("Invalid admin token provided during registration",
+		log.Warn("Invalid admin token provided during registration",
 			zap.String("login", login),
 		)
 		return nil, errors.NewUnauthorizedError("invalid admin token")
 	}
 
 	if err := utils.ValidateLogin(login); err != nil {
-		s.logger.Warn("Invalid login format during registration",
+		log.Warn("Invalid login format during registration",
 			zap.String("login", login),
 			zap.Error(err),
 		)
@@ -57,7 +75,7 @@ func (s *AuthService) Register(ctx context.Context, adminToken, login, password
 	}
 
 	if err := utils.ValidatePassword(password); err != nil {
-		s.logger.Warn("Invalid password format during registration",
+		log.Warn("Invalid password format during registration",
 			zap.String("login", login),
 			zap.Error(err),
 		)
@@ -65,7 +83,7 @@ func (s *AuthService) Register(ctx context.Context, adminToken, login, password
 	}
 
 	if _, err := s.userRepo.GetByLogin(ctx, login); err == nil {
-		s.logger.Warn("Attempt to register existing user",
+		log.Warn("Attempt to register existing user",
 			zap.String("login", login),
 		)
 		return nil, errors.NewBadRequestError("user already exists")
@@ -73,7 +91,7 @@ func (s *AuthService) Register(ctx context.Context, adminToken, login, password
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		s.logger.Error("Failed to hash password during registration",
+		log.Error("Failed to hash password during registration",
 			zap.String("login", login),
 			zap.Error(err),
 		)
@@ -86,14 +104,14 @@ func (s *AuthService) Register(ctx context.Context, adminToken, login, password
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
-		s.logger.Error("Failed to create user in repository",
+		log.Error("Failed to create user in repository",
 			zap.String("login", login),
 			zap.Error(err),
 		)
 		return nil, errors.NewInternalError("failed to create user")
 	}
 
-	s.logger.Info("User registered successfully",
+	log.Info("User registered successfully",
 		zap.String("user_id", user.ID),
 		zap.String("login", login),
 	)
@@ -101,14 +119,25 @@ func (s *AuthService) Register(ctx context.Context, adminToken, login, password
 	return user, nil
 }
 
-func (s *AuthService) Authenticate(ctx context.Context, login, password string) (string, error) {
-	s.logger.Debug("Authentication attempt",
+func (s *AuthService) Authenticate(ctx context.Context, login, password string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "AuthService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	token, err := s.authenticate(ctx, login, password)
+	s.audit.RecordResult(ctx, login, entities.AuditActionLogin, entities.AuditTargetUser, login, err)
+	return token, err
+}
+
+func (s *AuthService) authenticate(ctx context.Context, login, password string) (string, error) {
+	log := logger.FromContext(ctx)
+
+	log.Debug("Authentication attempt",
 		zap.String("login", login),
 	)
 
 	user, err := s.userRepo.GetByLogin(ctx, login)
 	if err != nil {
-		s.logger.Warn("Authentication failed - user not found",
+		log.Warn("Authentication failed - user not found",
 			zap.String("login", login),
 			zap.Error(err),
 		)
@@ -116,7 +145,7 @@ func (s *AuthService) Authenticate(ctx context.Context, login, password string)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		s.logger.Warn("Authentication failed - invalid password",
+		log.Warn("Authentication failed - invalid password",
 			zap.String("login", login),
 			zap.String("user_id", user.ID),
 		)
@@ -130,14 +159,14 @@ func (s *AuthService) Authenticate(ctx context.Context, login, password string)
 		ExpiresAt: time.Now().Add(s.tokenDuration),
 	}
 
-	s.logger.Debug("Creating session for authenticated user",
+	log.Debug("Creating session for authenticated user",
 		zap.String("user_id", user.ID),
 		zap.String("login", login),
 		zap.Time("expires_at", session.ExpiresAt),
 	)
 
 	if err := s.sessionRepo.Create(ctx, session); err != nil {
-		s.logger.Error("Failed to create session",
+		log.Error("Failed to create session",
 			zap.String("user_id", user.ID),
 			zap.String("login", login),
 			zap.Error(err),
@@ -145,7 +174,7 @@ func (s *AuthService) Authenticate(ctx context.Context, login, password string)
 		return "", errors.NewInternalError("failed to create session")
 	}
 
-	s.logger.Info("User authenticated successfully",
+	log.Info("User authenticated successfully",
 		zap.String("user_id", user.ID),
 		zap.String("login", login),
 		zap.Duration("token_duration", s.tokenDuration),
@@ -154,21 +183,26 @@ func (s *AuthService) Authenticate(ctx context.Context, login, password string)
 	return token, nil
 }
 
-func (s *AuthService) GetUserByLogin(ctx context.Context, login string) (*entities.User, error) {
-	s.logger.Debug("Getting user by login",
+func (s *AuthService) GetUserByLogin(ctx context.Context, login string) (_ *entities.User, err error) {
+	ctx, span := startSpan(ctx, "AuthService.GetUserByLogin")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Getting user by login",
 		zap.String("login", login),
 	)
 
-	user, err := s.userRepo.GetByLogin(ctx, login)
+	user, err := s.users.UserByLogin(ctx, login)
 	if err != nil {
-		s.logger.Error("Failed to get user by login",
+		log.Error("Failed to get user by login",
 			zap.String("login", login),
 			zap.Error(err),
 		)
 		return nil, err
 	}
 
-	s.logger.Debug("User retrieved successfully by login",
+	log.Debug("User retrieved successfully by login",
 		zap.String("user_id", user.ID),
 		zap.String("login", login),
 	)
@@ -176,36 +210,41 @@ func (s *AuthService) GetUserByLogin(ctx context.Context, login string) (*entiti
 	return user, nil
 }
 
-func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entities.User, error) {
-	s.logger.Debug("Validating token")
+func (s *AuthService) ValidateToken(ctx context.Context, token string) (_ *entities.User, err error) {
+	ctx, span := startSpan(ctx, "AuthService.ValidateToken")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
 
-	session, err := s.sessionRepo.GetByToken(ctx, token)
+	log.Debug("Validating token")
+
+	session, err := s.users.Session(ctx, token)
 	if err != nil {
-		s.logger.Warn("Token validation failed - session not found",
+		log.Warn("Token validation failed - session not found",
 			zap.Error(err),
 		)
 		return nil, errors.NewUnauthorizedError("invalid token")
 	}
 
-	s.logger.Debug("Session found for token",
+	log.Debug("Session found for token",
 		zap.String("user_id", session.UserID),
 		zap.Time("expires_at", session.ExpiresAt),
 	)
 
 	if session.ExpiresAt.Before(time.Now()) {
-		s.logger.Warn("Token validation failed - token expired",
+		log.Warn("Token validation failed - token expired",
 			zap.String("user_id", session.UserID),
 			zap.Time("expires_at", session.ExpiresAt),
 		)
 
 		go func() {
-			if err := s.sessionRepo.Delete(context.Background(), token); err != nil {
-				s.logger.Error("Failed to delete expired session",
+			if err := s.users.RevokeSession(context.Background(), token); err != nil {
+				log.Error("Failed to delete expired session",
 					zap.String("user_id", session.UserID),
 					zap.Error(err),
 				)
 			} else {
-				s.logger.Debug("Expired session deleted",
+				log.Debug("Expired session deleted",
 					zap.String("user_id", session.UserID),
 				)
 			}
@@ -214,16 +253,16 @@ func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entitie
 		return nil, errors.NewUnauthorizedError("token expired")
 	}
 
-	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	user, err := s.users.UserByID(ctx, session.UserID)
 	if err != nil {
-		s.logger.Error("Token validation failed - user not found",
+		log.Error("Token validation failed - user not found",
 			zap.String("user_id", session.UserID),
 			zap.Error(err),
 		)
 		return nil, errors.NewUnauthorizedError("user not found")
 	}
 
-	s.logger.Debug("Token validated successfully",
+	log.Debug("Token validated successfully",
 		zap.String("user_id", user.ID),
 		zap.String("login", user.Login),
 		zap.Time("expires_at", session.ExpiresAt),
@@ -232,32 +271,57 @@ func (s *AuthService) ValidateToken(ctx context.Context, token string) (*entitie
 	return user, nil
 }
 
-func (s *AuthService) Logout(ctx context.Context, token string) error {
-	s.logger.Debug("Logout attempt")
+func (s *AuthService) Logout(ctx context.Context, token string) (err error) {
+	ctx, span := startSpan(ctx, "AuthService.Logout")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Logout attempt")
 
-	session, err := s.sessionRepo.GetByToken(ctx, token)
+	session, err := s.users.Session(ctx, token)
 	if err != nil {
-		s.logger.Warn("Logout attempt with invalid token",
+		log.Warn("Logout attempt with invalid token",
 			zap.Error(err),
 		)
-		return s.sessionRepo.Delete(ctx, token)
+		return s.users.RevokeSession(ctx, token)
 	}
 
-	s.logger.Debug("Session found for logout",
+	log.Debug("Session found for logout",
 		zap.String("user_id", session.UserID),
 	)
 
-	if err := s.sessionRepo.Delete(ctx, token); err != nil {
-		s.logger.Error("Failed to delete session during logout",
+	if err := s.users.RevokeSession(ctx, token); err != nil {
+		log.Error("Failed to delete session during logout",
 			zap.String("user_id", session.UserID),
 			zap.Error(err),
 		)
 		return err
 	}
 
-	s.logger.Info("User logged out successfully",
+	log.Info("User logged out successfully",
 		zap.String("user_id", session.UserID),
 	)
 
+	actor := ""
+	if user, err := s.users.UserByID(ctx, session.UserID); err == nil {
+		actor = user.Login
+	}
+	s.audit.RecordResult(ctx, actor, entities.AuditActionLogout, entities.AuditTargetUser, actor, nil)
+
 	return nil
 }
+
+// ValidateAdminToken checks the token guarding administrative endpoints.
+func (s *AuthService) ValidateAdminToken(ctx context.Context, token string) error {
+	if !s.IsAdminToken(token) {
+		logger.FromContext(ctx).Warn("Invalid admin token provided")
+		return errors.NewUnauthorizedError("invalid admin token")
+	}
+	return nil
+}
+
+// IsAdminToken reports whether token is the admin token.
+func (s *AuthService) IsAdminToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
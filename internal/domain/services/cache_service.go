@@ -2,65 +2,203 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
 	"document-server/internal/domain/entities"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrCacheMiss is returned by RedisClient.Get for keys that do not exist.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheUnavailable is returned by a RedisClient that is not calling
+	// Redis while it is down; callers go to the database instead.
+	ErrCacheUnavailable = errors.New("cache unavailable")
+)
+
 type CacheService interface {
-	GetDocument(ctx context.Context, docID string) (*entities.Document, error)
+	// GetDocument returns the cached document and whether it is still within
+	// its soft TTL. Stale documents are served while they are refreshed.
+	GetDocument(ctx context.Context, docID string) (*entities.Document, bool, error)
 	SetDocument(ctx context.Context, doc *entities.Document) error
+	// LockDocumentLoad claims loading docID from the database for a short
+	// while, so replicas missing it at once do not all query it. It reports
+	// false while another replica holds the claim, and always succeeds when
+	// load locks are disabled.
+	LockDocumentLoad(ctx context.Context, docID string) (bool, error)
+	UnlockDocumentLoad(ctx context.Context, docID string) error
 	GetDocumentList(ctx context.Context, key string) ([]*entities.Document, error)
-	SetDocumentList(ctx context.Context, key string, docs []*entities.Document) error
+	// SetDocumentList caches the list stored at key, which must come from
+	// ListCacheKey for a filter on ownerID's documents.
+	SetDocumentList(ctx context.Context, ownerID, key string, docs []*entities.Document) error
+	// InvalidateDocument drops the cached document and every cached list
+	// that contains it.
 	InvalidateDocument(ctx context.Context, docID string) error
+	// InvalidatePrefix drops every key starting with prefix. It walks the
+	// keyspace page by page, so use it for maintenance rather than on writes.
 	InvalidatePrefix(ctx context.Context, prefix string) error
-	InvalidateUserLists(ctx context.Context, userLogin string) error
-	GetListCacheKey(filter *entities.DocumentFilter) string
+	// ListCacheKey returns the key of the list for filter in the current
+	// namespace of the list owner.
+	ListCacheKey(ctx context.Context, filter *entities.DocumentFilter) (string, error)
+	// InvalidateOwnerLists moves the lists of ownerID's documents to a new
+	// namespace, so every cached list of them, whoever requested it, is
+	// missed from then on, and drops the lists already cached.
+	InvalidateOwnerLists(ctx context.Context, ownerID string) error
+
+	GetSession(ctx context.Context, token string) (*entities.Session, error)
+	// SetSession caches session unless its token is cached already, which
+	// includes tokens revoked a moment ago.
+	SetSession(ctx context.Context, session *entities.Session) error
+	// InvalidateSession keeps the session of token from being served or
+	// cached again until any copy read before its revocation is stale.
+	InvalidateSession(ctx context.Context, token string) error
+	// GetUserByID and GetUserByLogin return users without their password
+	// hash, which is never cached.
+	GetUserByID(ctx context.Context, userID string) (*entities.User, error)
+	GetUserByLogin(ctx context.Context, login string) (*entities.User, error)
+	SetUser(ctx context.Context, user *entities.User) error
 }
 
 type RedisClient interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value any, duration time.Duration) error
+	// SetNX sets key only if it does not exist and reports whether it did.
+	SetNX(ctx context.Context, key string, value any, duration time.Duration) (bool, error)
 	Del(ctx context.Context, keys ...string) error
-	Keys(ctx context.Context, pattern string) ([]string, error)
+	// Scan calls fn with each page of the keys matching the glob pattern
+	// match, about count keys at a time, until the keyspace is walked or fn
+	// fails.
+	Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// Pipelined sends the commands queued by fn in a single round trip.
+	Pipelined(ctx context.Context, fn func(pipe RedisPipeliner)) error
+}
+
+// RedisPipeliner queues write commands for RedisClient.Pipelined.
+type RedisPipeliner interface {
+	Set(key string, value any, duration time.Duration)
+	Incr(key string)
+	Expire(key string, duration time.Duration)
+	SAdd(key string, members ...string)
+	SRem(key string, members ...string)
+	// Unlink deletes keys, reclaiming their memory in the background. The
+	// keys need not share a hash slot.
+	Unlink(keys ...string)
+}
+
+// scanPageSize is the COUNT hint of the SCAN calls of InvalidatePrefix.
+const scanPageSize = 500
+
+type CacheTTLs struct {
+	// Soft is how long cached values are served as fresh.
+	Soft time.Duration
+	// Hard is how long documents stay cached; past Soft they are served
+	// stale while one request refreshes them.
+	Hard time.Duration
+	// LoadLock is how long a replica may hold a document load claim; zero
+	// disables load locks.
+	LoadLock time.Duration
+	// Session and User bound how long a revoked session or a changed user
+	// could be served if their invalidation is lost.
+	Session time.Duration
+	User    time.Duration
 }
 
 type redisCacheService struct {
-	client        RedisClient
-	cacheDuration time.Duration
+	client RedisClient
+	ttls   CacheTTLs
+	now    func() time.Time
 }
 
-func NewRedisCacheService(client RedisClient, cacheDuration time.Duration) *redisCacheService {
+func NewRedisCacheService(client RedisClient, ttls CacheTTLs) *redisCacheService {
+	if ttls.Soft <= 0 {
+		ttls.Soft = 30 * time.Minute
+	}
+	if ttls.Hard < ttls.Soft {
+		ttls.Hard = ttls.Soft
+	}
+	if ttls.Session <= 0 {
+		ttls.Session = 30 * time.Second
+	}
+	if ttls.User <= 0 {
+		ttls.User = time.Minute
+	}
+
 	return &redisCacheService{
-		client:        client,
-		cacheDuration: cacheDuration,
+		client: client,
+		ttls:   ttls,
+		now:    time.Now,
 	}
 }
 
-func (s *redisCacheService) GetDocument(ctx context.Context, docID string) (*entities.Document, error) {
-	key := fmt.Sprintf("doc:%s", docID)
-	data, err := s.client.Get(ctx, key)
+// cachedDocument is a document as stored in Redis, with the end of its soft
+// TTL.
+type cachedDocument struct {
+	Document   *entities.Document `json:"document"`
+	FreshUntil time.Time          `json:"fresh_until"`
+}
+
+func (s *redisCacheService) GetDocument(ctx context.Context, docID string) (*entities.Document, bool, error) {
+	data, err := s.client.Get(ctx, documentCacheKey(docID))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	var doc entities.Document
-	if err := json.Unmarshal([]byte(data), &doc); err != nil {
-		return nil, err
+	var cached cachedDocument
+	if err := json.Unmarshal([]byte(data), &cached); err != nil {
+		return nil, false, err
+	}
+	if cached.Document == nil {
+		return nil, false, ErrCacheMiss
 	}
 
-	return &doc, nil
+	return cached.Document, s.now().Before(cached.FreshUntil), nil
 }
 
 func (s *redisCacheService) SetDocument(ctx context.Context, doc *entities.Document) error {
-	key := fmt.Sprintf("doc:%s", doc.ID)
-	data, err := json.Marshal(doc)
+	data, err := json.Marshal(&cachedDocument{
+		Document:   doc,
+		FreshUntil: s.now().Add(s.ttls.Soft),
+	})
 	if err != nil {
 		return err
 	}
 
-	return s.client.Set(ctx, key, data, s.cacheDuration)
+	return s.client.Set(ctx, documentCacheKey(doc.ID), data, s.ttls.Hard)
+}
+
+// Keys that are written or dropped together carry the same hash tag - the
+// part in braces - so Redis Cluster keeps them in one slot: a document's
+// keys are tagged with its ID, and an owner's lists, tag set and generation
+// with the owner.
+func documentCacheKey(docID string) string {
+	return fmt.Sprintf("doc:{%s}", docID)
+}
+
+func documentLoadLockKey(docID string) string {
+	return fmt.Sprintf("lock:load:doc:{%s}", docID)
+}
+
+func (s *redisCacheService) LockDocumentLoad(ctx context.Context, docID string) (bool, error) {
+	if s.ttls.LoadLock <= 0 {
+		return true, nil
+	}
+	return s.client.SetNX(ctx, documentLoadLockKey(docID), 1, s.ttls.LoadLock)
+}
+
+// UnlockDocumentLoad releases the claim without checking who holds it: a
+// claim that outlived its TTL and was taken over may be released early,
+// which only lets another load through.
+func (s *redisCacheService) UnlockDocumentLoad(ctx context.Context, docID string) error {
+	if s.ttls.LoadLock <= 0 {
+		return nil
+	}
+	return s.client.Del(ctx, documentLoadLockKey(docID))
 }
 
 func (s *redisCacheService) GetDocumentList(ctx context.Context, key string) ([]*entities.Document, error) {
@@ -77,58 +215,152 @@ func (s *redisCacheService) GetDocumentList(ctx context.Context, key string) ([]
 	return docs, nil
 }
 
-func (s *redisCacheService) SetDocumentList(ctx context.Context, key string, docs []*entities.Document) error {
+// Every cached list is registered in the tag set of its owner and in the tag
+// sets of the documents it contains, so invalidation reads the keys to drop
+// with SMEMBERS instead of searching the keyspace for them. Tag sets live as
+// long as the newest list in them; members whose list already expired are
+// harmless and go away with the set.
+func ownerListsTag(ownerID string) string {
+	return fmt.Sprintf("docs:{owner=%s}:lists", ownerID)
+}
+
+func documentListsTag(docID string) string {
+	return fmt.Sprintf("doc:{%s}:lists", docID)
+}
+
+func (s *redisCacheService) SetDocumentList(ctx context.Context, ownerID, key string, docs []*entities.Document) error {
 	data, err := json.Marshal(docs)
 	if err != nil {
 		return err
 	}
 
-	listTTL := s.cacheDuration / 2
+	listTTL := s.ttls.Soft
 
-	return s.client.Set(ctx, key, data, listTTL)
+	return s.client.Pipelined(ctx, func(pipe RedisPipeliner) {
+		pipe.Set(key, data, listTTL)
+		pipe.SAdd(ownerListsTag(ownerID), key)
+		pipe.Expire(ownerListsTag(ownerID), listTTL)
+		for _, doc := range docs {
+			pipe.SAdd(documentListsTag(doc.ID), key)
+			pipe.Expire(documentListsTag(doc.ID), listTTL)
+		}
+	})
 }
 
 func (s *redisCacheService) InvalidateDocument(ctx context.Context, docID string) error {
-	key := fmt.Sprintf("doc:%s", docID)
-	return s.client.Del(ctx, key)
-}
-
-func (s *redisCacheService) InvalidatePrefix(ctx context.Context, prefix string) error {
-	pattern := fmt.Sprintf("%s*", prefix)
-	keys, err := s.client.Keys(ctx, pattern)
+	tag := documentListsTag(docID)
+	lists, err := s.client.SMembers(ctx, tag)
 	if err != nil {
 		return err
 	}
 
-	if len(keys) > 0 {
-		return s.client.Del(ctx, keys...)
-	}
+	return s.client.Pipelined(ctx, func(pipe RedisPipeliner) {
+		pipe.Unlink(append(lists, documentCacheKey(docID))...)
+		if len(lists) > 0 {
+			pipe.SRem(tag, lists...)
+		}
+	})
+}
 
-	return nil
+// InvalidatePrefix bumps the list generation counters under prefix instead of
+// dropping them: counting again from zero would bring back lists cached under
+// generations already retired.
+func (s *redisCacheService) InvalidatePrefix(ctx context.Context, prefix string) error {
+	return s.client.Scan(ctx, prefix+"*", scanPageSize, func(keys []string) error {
+		return s.client.Pipelined(ctx, func(pipe RedisPipeliner) {
+			drop := make([]string, 0, len(keys))
+			for _, key := range keys {
+				if isListGenerationKey(key) {
+					pipe.Incr(key)
+				} else {
+					drop = append(drop, key)
+				}
+			}
+			if len(drop) > 0 {
+				pipe.Unlink(drop...)
+			}
+		})
+	})
 }
 
-func (s *redisCacheService) InvalidateUserLists(ctx context.Context, userLogin string) error {
-	patterns := []string{
-		fmt.Sprintf("docs:list:owner=%s:*", userLogin),
-		fmt.Sprintf("docs:list:*:user=%s:*", userLogin),
-	}
+// Lists are always scoped to one owner's documents, so any change to one of
+// them - creation, deletion, update, grant change or public flip - can only
+// alter lists of that owner. Each owner has a generation counter that is part
+// of their list keys; bumping it retires all of their lists at once, even
+// those whose tag set entry was lost, and the tag set frees their memory.
+func listGenerationKey(ownerID string) string {
+	return fmt.Sprintf("docs:{owner=%s}:gen", ownerID)
+}
 
-	for _, pattern := range patterns {
-		if err := s.InvalidatePrefix(ctx, pattern); err != nil {
-			return err
+func isListGenerationKey(key string) bool {
+	return strings.HasPrefix(key, "docs:{owner=") && strings.HasSuffix(key, "}:gen")
+}
+
+// ownerListsPrefix starts the keys of every list of ownerID's documents.
+func ownerListsPrefix(ownerID string) string {
+	return fmt.Sprintf("docs:{owner=%s}:list:", ownerID)
+}
+
+func (s *redisCacheService) ListCacheKey(ctx context.Context, filter *entities.DocumentFilter) (string, error) {
+	var generation int64
+	data, err := s.client.Get(ctx, listGenerationKey(filter.OwnerID))
+	switch {
+	case err == nil:
+		generation, err = strconv.ParseInt(data, 10, 64)
+		if err != nil {
+			return "", err
 		}
+	case !errors.Is(err, ErrCacheMiss):
+		return "", err
+	}
+
+	fields := make([]string, len(filter.Fields))
+	for i, field := range filter.Fields {
+		fields[i] = field.String()
+	}
+
+	// The filter values are free text, so they are hashed rather than joined
+	// into the key, where one value could pass for another plus a separator.
+	components, err := json.Marshal(struct {
+		User      string   `json:"user"`
+		Key       string   `json:"key"`
+		Value     string   `json:"val"`
+		Mode      string   `json:"mode"`
+		Threshold *float64 `json:"th"`
+		Fields    []string `json:"fields"`
+		Limit     int      `json:"limit"`
+	}{
+		User:      filter.RequestingUserLogin,
+		Key:       filter.Key,
+		Value:     filter.Value,
+		Mode:      filter.Mode,
+		Threshold: filter.Threshold,
+		Fields:    fields,
+		Limit:     filter.Limit,
+	})
+	if err != nil {
+		return "", err
 	}
+	sum := sha256.Sum256(components)
 
-	return nil
+	return fmt.Sprintf("%sgen=%d:%s", ownerListsPrefix(filter.OwnerID), generation, hex.EncodeToString(sum[:])), nil
 }
 
-func (s *redisCacheService) GetListCacheKey(filter *entities.DocumentFilter) string {
-	return fmt.Sprintf(
-		"docs:list:owner=%s:user=%s:key=%s:val=%s:limit=%d",
-		filter.OwnerID,
-		filter.RequestingUserLogin,
-		filter.Key,
-		filter.Value,
-		filter.Limit,
-	)
+func (s *redisCacheService) InvalidateOwnerLists(ctx context.Context, ownerID string) error {
+	tag := ownerListsTag(ownerID)
+	lists, err := s.client.SMembers(ctx, tag)
+	if err != nil {
+		return err
+	}
+
+	// Only the members read are removed from the tag: lists cached in the
+	// meantime are under the old generation too, but stay tagged until the
+	// next invalidation drops them.
+	return s.client.Pipelined(ctx, func(pipe RedisPipeliner) {
+		pipe.Incr(listGenerationKey(ownerID))
+		if len(lists) > 0 {
+			pipe.Unlink(lists...)
+			pipe.SRem(tag, lists...)
+		}
+	})
 }
@@ -0,0 +1,287 @@
+package services_test
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/services"
+	"document-server/internal/infrastructure/cache"
+	stdErrors "errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ownerFilter(ownerID, login string) *entities.DocumentFilter {
+	return &entities.DocumentFilter{OwnerID: ownerID, RequestingUserLogin: login}
+}
+
+// cacheList caches docs as the list of ownerID's documents requested by
+// login and returns its key.
+func cacheList(t *testing.T, svc services.CacheService, ownerID, login string, docs ...*entities.Document) string {
+	t.Helper()
+
+	ctx := context.Background()
+	key, err := svc.ListCacheKey(ctx, ownerFilter(ownerID, login))
+	if err != nil {
+		t.Fatalf("list cache key: %v", err)
+	}
+	if err := svc.SetDocumentList(ctx, ownerID, key, docs); err != nil {
+		t.Fatalf("set document list: %v", err)
+	}
+	return key
+}
+
+func assertListCached(t *testing.T, svc services.CacheService, key string, cached bool) {
+	t.Helper()
+
+	_, err := svc.GetDocumentList(context.Background(), key)
+	switch {
+	case cached && err != nil:
+		t.Errorf("list %s: %v, want cached", key, err)
+	case !cached && !stdErrors.Is(err, services.ErrCacheMiss):
+		t.Errorf("list %s: %v, want %v", key, err, services.ErrCacheMiss)
+	}
+}
+
+func assertMembers(t *testing.T, memory *cache.MemoryCache, tag string, want ...string) {
+	t.Helper()
+
+	members, err := memory.SMembers(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("members of %s: %v", tag, err)
+	}
+	slices.Sort(want)
+	if !slices.Equal(members, want) {
+		t.Errorf("members of %s = %v, want %v", tag, members, want)
+	}
+}
+
+func TestRedisCacheServiceSetDocumentListTagsList(t *testing.T) {
+	memory := cache.NewMemoryCache()
+	svc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+
+	a := &entities.Document{ID: "a", OwnerID: "o1"}
+	b := &entities.Document{ID: "b", OwnerID: "o1"}
+	alice := cacheList(t, svc, "o1", "alice", a, b)
+	bob := cacheList(t, svc, "o1", "bob", b)
+
+	assertMembers(t, memory, "docs:{owner=o1}:lists", alice, bob)
+	assertMembers(t, memory, "doc:{a}:lists", alice)
+	assertMembers(t, memory, "doc:{b}:lists", alice, bob)
+}
+
+func TestRedisCacheServiceInvalidateDocument(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryCache()
+	svc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+
+	a := &entities.Document{ID: "a", OwnerID: "o1"}
+	b := &entities.Document{ID: "b", OwnerID: "o1"}
+	c := &entities.Document{ID: "c", OwnerID: "o2"}
+	if err := svc.SetDocument(ctx, a); err != nil {
+		t.Fatalf("set document: %v", err)
+	}
+	withA := cacheList(t, svc, "o1", "alice", a, b)
+	withoutA := cacheList(t, svc, "o1", "bob", b)
+	other := cacheList(t, svc, "o2", "alice", c)
+
+	if err := svc.InvalidateDocument(ctx, "a"); err != nil {
+		t.Fatalf("invalidate document: %v", err)
+	}
+
+	if _, _, err := svc.GetDocument(ctx, "a"); !stdErrors.Is(err, services.ErrCacheMiss) {
+		t.Errorf("get document after invalidation: %v, want %v", err, services.ErrCacheMiss)
+	}
+	assertListCached(t, svc, withA, false)
+	assertListCached(t, svc, withoutA, true)
+	assertListCached(t, svc, other, true)
+	assertMembers(t, memory, "doc:{a}:lists")
+	assertMembers(t, memory, "doc:{b}:lists", withA, withoutA)
+}
+
+func TestRedisCacheServiceInvalidateOwnerLists(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryCache()
+	svc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+
+	a := &entities.Document{ID: "a", OwnerID: "o1"}
+	c := &entities.Document{ID: "c", OwnerID: "o2"}
+	alice := cacheList(t, svc, "o1", "alice", a)
+	bob := cacheList(t, svc, "o1", "bob")
+	other := cacheList(t, svc, "o2", "alice", c)
+
+	if err := svc.InvalidateOwnerLists(ctx, "o1"); err != nil {
+		t.Fatalf("invalidate owner lists: %v", err)
+	}
+
+	assertListCached(t, svc, alice, false)
+	assertListCached(t, svc, bob, false)
+	assertListCached(t, svc, other, true)
+	assertMembers(t, memory, "docs:{owner=o1}:lists")
+	assertMembers(t, memory, "docs:{owner=o2}:lists", other)
+
+	// A list read before the invalidation and cached after it lands under
+	// the old generation, which is never read again.
+	key, err := svc.ListCacheKey(ctx, ownerFilter("o1", "alice"))
+	if err != nil {
+		t.Fatalf("list cache key: %v", err)
+	}
+	if key == alice {
+		t.Fatalf("list cache key %s unchanged by invalidation", key)
+	}
+	if err := svc.SetDocumentList(ctx, "o1", alice, []*entities.Document{a}); err != nil {
+		t.Fatalf("set document list: %v", err)
+	}
+	assertListCached(t, svc, key, false)
+
+	otherKey, err := svc.ListCacheKey(ctx, ownerFilter("o2", "alice"))
+	if err != nil {
+		t.Fatalf("list cache key: %v", err)
+	}
+	if otherKey != other {
+		t.Errorf("list cache key of other owner = %s, want %s", otherKey, other)
+	}
+}
+
+func TestRedisCacheServiceListCacheKeyDoesNotCollide(t *testing.T) {
+	ctx := context.Background()
+	svc := services.NewRedisCacheService(cache.NewMemoryCache(), services.CacheTTLs{})
+
+	// Joined into a key, the separators inside the values made these equal.
+	filters := []*entities.DocumentFilter{
+		{OwnerID: "o1", RequestingUserLogin: "alice", Key: "k:val=v", Value: "x"},
+		{OwnerID: "o1", RequestingUserLogin: "alice", Key: "k", Value: "v:val=x"},
+		{OwnerID: "o1", RequestingUserLogin: "alice:key=k", Value: "x"},
+	}
+
+	seen := make(map[string]int)
+	for i, filter := range filters {
+		key, err := svc.ListCacheKey(ctx, filter)
+		if err != nil {
+			t.Fatalf("list cache key: %v", err)
+		}
+		if !strings.HasPrefix(key, "docs:{owner=o1}:list:gen=0:") {
+			t.Errorf("list cache key %s outside the owner's generation", key)
+		}
+		if j, ok := seen[key]; ok {
+			t.Errorf("filters %d and %d share list cache key %s", j, i, key)
+		}
+		seen[key] = i
+	}
+}
+
+// pagedCache counts the pages Scan hands out.
+type pagedCache struct {
+	*cache.MemoryCache
+	pages int
+}
+
+func (c *pagedCache) Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	return c.MemoryCache.Scan(ctx, match, count, func(keys []string) error {
+		c.pages++
+		return fn(keys)
+	})
+}
+
+func TestRedisCacheServiceInvalidatePrefix(t *testing.T) {
+	ctx := context.Background()
+	memory := &pagedCache{MemoryCache: cache.NewMemoryCache()}
+	svc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+
+	// Enough keys for several pages, interleaved with keys to keep.
+	const dropped = 1200
+	for i := range dropped {
+		if err := memory.Set(ctx, fmt.Sprintf("tmp:%d", i), i, 0); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		if i%4 == 0 {
+			if err := memory.Set(ctx, fmt.Sprintf("keep:%d", i), i, 0); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+		}
+	}
+
+	if err := svc.InvalidatePrefix(ctx, "tmp:"); err != nil {
+		t.Fatalf("invalidate prefix: %v", err)
+	}
+
+	if memory.pages < 2 {
+		t.Errorf("scanned %d pages, want the keyspace walked page by page", memory.pages)
+	}
+
+	var left, kept int
+	err := memory.MemoryCache.Scan(ctx, "*", 1000, func(keys []string) error {
+		for _, key := range keys {
+			if _, err := fmt.Sscanf(key, "tmp:%d", new(int)); err == nil {
+				left++
+			} else {
+				kept++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("%d keys left under the prefix, want none", left)
+	}
+	if kept != dropped/4 {
+		t.Errorf("%d other keys kept, want %d", kept, dropped/4)
+	}
+}
+
+func TestRedisCacheServiceInvalidatePrefixKeepsListGenerations(t *testing.T) {
+	ctx := context.Background()
+	svc := services.NewRedisCacheService(cache.NewMemoryCache(), services.CacheTTLs{})
+
+	a := &entities.Document{ID: "a", OwnerID: "o1"}
+	if err := svc.InvalidateOwnerLists(ctx, "o1"); err != nil {
+		t.Fatalf("invalidate owner lists: %v", err)
+	}
+	stale := cacheList(t, svc, "o1", "alice", a)
+
+	if err := svc.InvalidatePrefix(ctx, "docs:{"); err != nil {
+		t.Fatalf("invalidate prefix: %v", err)
+	}
+	assertListCached(t, svc, stale, false)
+
+	// A list read before the wipe and cached after it must not be served
+	// once the generation counts up again.
+	if err := svc.SetDocumentList(ctx, "o1", stale, []*entities.Document{a}); err != nil {
+		t.Fatalf("set document list: %v", err)
+	}
+	key, err := svc.ListCacheKey(ctx, ownerFilter("o1", "alice"))
+	if err != nil {
+		t.Fatalf("list cache key: %v", err)
+	}
+	if key == stale {
+		t.Fatalf("list cache key %s reused after the wipe", key)
+	}
+	if !strings.HasPrefix(key, "docs:{owner=o1}:list:gen=2:") {
+		t.Errorf("list cache key %s, want generation 2", key)
+	}
+}
+
+func TestRedisCacheServiceRevokedSessionIsNotCachedAgain(t *testing.T) {
+	ctx := context.Background()
+	svc := services.NewRedisCacheService(cache.NewMemoryCache(), services.CacheTTLs{})
+
+	session := &entities.Session{Token: "token", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := svc.SetSession(ctx, session); err != nil {
+		t.Fatalf("set session: %v", err)
+	}
+	if err := svc.InvalidateSession(ctx, session.Token); err != nil {
+		t.Fatalf("invalidate session: %v", err)
+	}
+
+	// A lookup that read the session before it was deleted caches it late.
+	if err := svc.SetSession(ctx, session); err != nil {
+		t.Fatalf("set session: %v", err)
+	}
+	if _, err := svc.GetSession(ctx, session.Token); !stdErrors.Is(err, services.ErrCacheMiss) {
+		t.Fatalf("get revoked session: %v, want %v", err, services.ErrCacheMiss)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"encoding/base64"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+
+	syncTokenPrefix = "c1:"
+)
+
+// Changes returns the changes after the sync token since, oldest first, as
+// user sees them: an upsert for each change to a document user can read and
+// a tombstone when a document user could read is deleted or stops being
+// visible to them. An empty since starts from the beginning of the log.
+func (s *DocumentService) Changes(ctx context.Context, user *entities.User, since string, limit int) (_ *entities.ChangeFeedPage, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Changes")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Listing document changes",
+		zap.String("user_login", user.Login),
+		zap.String("since", since),
+		zap.Int("limit", limit),
+	)
+
+	seq, err := decodeSyncToken(since)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultChangesLimit
+	}
+	if limit > maxChangesLimit {
+		limit = maxChangesLimit
+	}
+
+	changes, err := s.docRepo.ListChanges(ctx, user.ID, user.Login, seq, limit+1)
+	if err != nil {
+		log.Error("Failed to list document changes",
+			zap.String("user_login", user.Login),
+			zap.Int64("since", seq),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to list changes")
+	}
+
+	page := &entities.ChangeFeedPage{
+		Changes: []*entities.ChangeFeedEntry{},
+		HasMore: len(changes) > limit,
+	}
+	if page.HasMore {
+		changes = changes[:limit]
+	}
+
+	for _, change := range changes {
+		if entry := feedEntry(change, user); entry != nil {
+			page.Changes = append(page.Changes, entry)
+		}
+		seq = change.Seq
+	}
+	page.Next = encodeSyncToken(seq)
+
+	return page, nil
+}
+
+// feedEntry is change as seen by user, or nil if it does not concern them.
+func feedEntry(change *entities.DocumentChange, user *entities.User) *entities.ChangeFeedEntry {
+	entry := &entities.ChangeFeedEntry{
+		Kind:      entities.ChangeKindUpsert,
+		Document:  change.Document,
+		ChangedAt: change.ChangedAt,
+	}
+
+	switch {
+	case change.Op == entities.DocumentChangeDelete:
+		if !change.Access.Allows(user) {
+			return nil
+		}
+		entry.Kind = entities.ChangeKindTombstone
+		entry.Reason = entities.TombstoneDeleted
+	case change.Access.Allows(user):
+		entry.Grant = change.Access.Grant
+	case change.PrevAccess.Allows(user):
+		entry.Kind = entities.ChangeKindTombstone
+		entry.Reason = entities.TombstoneRevoked
+	default:
+		return nil
+	}
+
+	return entry
+}
+
+func encodeSyncToken(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(seq, 10)))
+}
+
+func decodeSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) <= len(syncTokenPrefix) || string(raw[:len(syncTokenPrefix)]) != syncTokenPrefix {
+		return 0, errors.NewBadRequestError("invalid sync token")
+	}
+
+	seq, err := strconv.ParseInt(string(raw[len(syncTokenPrefix):]), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, errors.NewBadRequestError("invalid sync token")
+	}
+
+	return seq, nil
+}
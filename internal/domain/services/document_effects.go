@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/pkg/errors"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// applyMutation is the outbox handler for committed document writes. It
+// drops the cached document and lists the write made stale, then publishes
+// the write to webhooks and event streams. A failed step makes the relay
+// retry the whole message, so every step is idempotent: events get IDs
+// derived from the message, and webhooks ignore events they already have.
+func (s *DocumentService) applyMutation(ctx context.Context, messageID int64, payload json.RawMessage) error {
+	var mutation entities.DocumentMutation
+	if err := json.Unmarshal(payload, &mutation); err != nil || mutation.Document == nil {
+		s.logger.Error("Dropping malformed document mutation",
+			zap.Int64("message_id", messageID),
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	if err := s.invalidateCaches(ctx, mutation.Document.ID, mutation.Document.OwnerID); err != nil {
+		return err
+	}
+
+	actor := mutation.Actor
+	if actor == "" {
+		// Creations are made by the owner, who is gone if their account was
+		// deleted along with the document.
+		owner, err := s.users.UserByID(ctx, mutation.Document.OwnerID)
+		if err != nil {
+			if _, ok := err.(*errors.NotFoundError); !ok {
+				return err
+			}
+		} else {
+			actor = owner.Login
+		}
+	}
+	if err := s.publishMutation(ctx, messageID, &mutation, actor); err != nil {
+		return err
+	}
+	return s.streamMutation(ctx, messageID, &mutation, actor)
+}
+
+// publishMutation queues the webhook events for a write. An access change
+// publishes document.shared for logins added to the grant list or the
+// document becoming public, and document.unshared for the reverse.
+func (s *DocumentService) publishMutation(ctx context.Context, messageID int64, mutation *entities.DocumentMutation, actor string) error {
+	event := func(eventType string) *entities.WebhookEvent {
+		return &entities.WebhookEvent{
+			ID:       outboxEventID(messageID, eventType),
+			Type:     eventType,
+			Actor:    actor,
+			Document: mutation.Document,
+		}
+	}
+
+	switch mutation.Op {
+	case entities.MutationCreated:
+		return s.webhooks.Publish(ctx, event(entities.WebhookEventDocumentCreated))
+	case entities.MutationUpdated:
+		return s.webhooks.Publish(ctx, event(entities.WebhookEventDocumentUpdated))
+	case entities.MutationDeleted:
+		return s.webhooks.Publish(ctx, event(entities.WebhookEventDocumentDeleted))
+	}
+
+	before, after := mutation.PrevAccess, mutation.Access
+	shared := event(entities.WebhookEventDocumentShared)
+	unshared := event(entities.WebhookEventDocumentUnshared)
+
+	for _, login := range after.Grant {
+		if !slices.Contains(before.Grant, login) {
+			shared.Logins = append(shared.Logins, login)
+		}
+	}
+	for _, login := range before.Grant {
+		if !slices.Contains(after.Grant, login) {
+			unshared.Logins = append(unshared.Logins, login)
+		}
+	}
+
+	if before.Public != after.Public {
+		public := after.Public
+		if public {
+			shared.Public = &public
+		} else {
+			unshared.Public = &public
+		}
+	}
+
+	if len(shared.Logins) > 0 || shared.Public != nil {
+		if err := s.webhooks.Publish(ctx, shared); err != nil {
+			return err
+		}
+	}
+	if len(unshared.Logins) > 0 || unshared.Public != nil {
+		if err := s.webhooks.Publish(ctx, unshared); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// streamMutation sends a write to the event streams of the users who could
+// read the document before or after it.
+func (s *DocumentService) streamMutation(ctx context.Context, messageID int64, mutation *entities.DocumentMutation, actor string) error {
+	eventType := entities.ChangeEventUpdated
+	switch mutation.Op {
+	case entities.MutationCreated:
+		eventType = entities.ChangeEventCreated
+	case entities.MutationDeleted:
+		eventType = entities.ChangeEventDeleted
+	case entities.MutationAccess:
+		eventType = entities.ChangeEventGrant
+	}
+
+	event := &entities.ChangeEvent{
+		ID:       outboxEventID(messageID, eventType),
+		Type:     eventType,
+		Actor:    actor,
+		Document: mutation.Document,
+	}
+	if eventType == entities.ChangeEventGrant {
+		event.Grant = mutation.Access.Grant
+	}
+
+	return s.events.Publish(ctx, event, mutation.PrevAccess, mutation.Access)
+}
+
+// outboxEventID derives a stable event ID from an outbox message, so a
+// message applied twice publishes the same event twice rather than two
+// events.
+func outboxEventID(messageID int64, eventType string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, fmt.Appendf(nil, "outbox/%d/%s", messageID, eventType)).String()
+}
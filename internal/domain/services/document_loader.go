@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/pkg/logger"
+	stdErrors "errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	documentLoadTimeout = 10 * time.Second
+	// documentLoadPoll is how often a replica waiting on another one's load
+	// looks for the result in the cache.
+	documentLoadPoll = 50 * time.Millisecond
+)
+
+// loadDocument reads a document missing from the cache from the database and
+// caches it. Concurrent misses of one document in this process share a
+// single load, and replicas take turns through the cache's load lock.
+func (s *DocumentService) loadDocument(ctx context.Context, docID string) (*entities.Document, error) {
+	result := s.loads.DoChan("load:"+docID, func() (any, error) {
+		return s.fetchDocument(ctx, docID, true)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		// Every caller gets its own copy of the shared result.
+		return res.Val.(*entities.Document).Clone(), nil
+	}
+}
+
+// refreshDocument reloads a stale cached document in the background, unless
+// a refresh of it is already running here or on another replica.
+func (s *DocumentService) refreshDocument(ctx context.Context, docID string) {
+	s.loads.DoChan("refresh:"+docID, func() (any, error) {
+		doc, err := s.fetchDocument(ctx, docID, false)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Failed to refresh cached document",
+				zap.String("doc_id", docID),
+				zap.Error(err),
+			)
+		}
+		return doc, err
+	})
+}
+
+// fetchDocument loads docID once this replica holds its load lock. While
+// another replica holds it, fetchDocument waits for that replica's result to
+// be cached when wait is set, and returns nothing otherwise. The load is
+// shared with other requests, so it logs for the request that started it but
+// does not end with it.
+func (s *DocumentService) fetchDocument(ctx context.Context, docID string, wait bool) (*entities.Document, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), documentLoadTimeout)
+	defer cancel()
+
+	log := logger.FromContext(ctx)
+
+	for {
+		locked, err := s.cache.LockDocumentLoad(ctx, docID)
+		if stdErrors.Is(err, ErrCacheUnavailable) {
+			break
+		}
+		if err != nil {
+			log.Warn("Failed to take document load lock, loading anyway",
+				zap.String("doc_id", docID),
+				zap.Error(err),
+			)
+			break
+		}
+		if locked {
+			defer func() {
+				if err := s.cache.UnlockDocumentLoad(ctx, docID); err != nil {
+					log.Warn("Failed to release document load lock",
+						zap.String("doc_id", docID),
+						zap.Error(err),
+					)
+				}
+			}()
+			break
+		}
+		if !wait {
+			return nil, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(documentLoadPoll):
+		}
+
+		if doc, _, err := s.cache.GetDocument(ctx, docID); err == nil {
+			log.Debug("Document loaded by another replica",
+				zap.String("doc_id", docID),
+			)
+			return doc, nil
+		}
+	}
+
+	doc, err := s.docRepo.GetByID(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.SetDocument(ctx, doc); stdErrors.Is(err, ErrCacheUnavailable) {
+		log.Debug("Cache unavailable, document not cached",
+			zap.String("doc_id", docID),
+		)
+	} else if err != nil {
+		log.Error("Failed to cache document",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+	} else {
+		log.Debug("Document cached successfully",
+			zap.String("doc_id", docID),
+		)
+	}
+
+	return doc, nil
+}
@@ -5,54 +5,131 @@ import (
 	"document-server/internal/domain/entities"
 	"document-server/internal/domain/repositories"
 	"document-server/pkg/errors"
+	"document-server/pkg/jsonpatch"
 	"document-server/pkg/logger"
 	"encoding/json"
-	"log"
+	stdErrors "errors"
+	"fmt"
+	"os"
 	"runtime"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	ContentTypeJSONPatch  = "application/json-patch+json"
+	ContentTypeMergePatch = "application/merge-patch+json"
+
+	maxPatchAttempts = 3
 )
 
 type DocumentService struct {
-	docRepo  repositories.DocumentRepository
-	userRepo repositories.UserRepository
-	cache    CacheService
-	logger   *zap.Logger
+	docRepo             repositories.DocumentRepository
+	users               *UserResolver
+	cache               CacheService
+	schemas             *SchemaService
+	audit               *AuditService
+	webhooks            *WebhookService
+	events              *EventService
+	outbox              *OutboxService
+	similarityThreshold float64
+	suggestLimit        int
+	lockTTL             time.Duration
+	maxLockTTL          time.Duration
+	loads               singleflight.Group
+	logger              *zap.Logger
 }
 
 func NewDocumentService(
 	docRepo repositories.DocumentRepository,
-	userRepo repositories.UserRepository,
+	users *UserResolver,
 	cache CacheService,
+	schemas *SchemaService,
+	audit *AuditService,
+	webhooks *WebhookService,
+	events *EventService,
+	outbox *OutboxService,
+	similarityThreshold float64,
+	suggestLimit int,
+	lockTTL, maxLockTTL time.Duration,
 ) *DocumentService {
-	return &DocumentService{
-		docRepo:  docRepo,
-		userRepo: userRepo,
-		cache:    cache,
-		logger:   logger.Logger,
+	s := &DocumentService{
+		docRepo:             docRepo,
+		users:               users,
+		cache:               cache,
+		schemas:             schemas,
+		audit:               audit,
+		webhooks:            webhooks,
+		events:              events,
+		outbox:              outbox,
+		similarityThreshold: similarityThreshold,
+		suggestLimit:        suggestLimit,
+		lockTTL:             lockTTL,
+		maxLockTTL:          maxLockTTL,
+		logger:              logger.Logger,
 	}
+
+	outbox.Handle(entities.OutboxKindDocumentMutation, s.applyMutation)
+
+	return s
 }
 
 func (s *DocumentService) Create(
 	ctx context.Context,
-	userID, name, mime string,
+	user *entities.User,
+	name, mime string,
 	isFile, isPublic bool,
 	filePath *string,
 	jsonData *json.RawMessage,
 	grant []string,
+	schemaName string,
+) (_ *entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Create")
+	defer func() { endSpan(span, err) }()
+
+	doc, err := s.create(ctx, user, name, mime, isFile, isPublic, filePath, jsonData, grant, schemaName)
+
+	docID := ""
+	if doc != nil {
+		docID = doc.ID
+	}
+	s.audit.RecordResult(ctx, user.Login, entities.AuditActionDocumentCreate, entities.AuditTargetDocument, docID, err)
+
+	return doc, err
+}
+
+func (s *DocumentService) create(
+	ctx context.Context,
+	user *entities.User,
+	name, mime string,
+	isFile, isPublic bool,
+	filePath *string,
+	jsonData *json.RawMessage,
+	grant []string,
+	schemaName string,
 ) (*entities.Document, error) {
-	s.logger.Debug("Creating document",
+	userID := user.ID
+
+	logger.FromContext(ctx).Debug("Creating document",
 		zap.String("user_id", userID),
 		zap.String("name", name),
 		zap.String("mime", mime),
 		zap.Bool("is_file", isFile),
 		zap.Bool("is_public", isPublic),
 		zap.Strings("grant", grant),
+		zap.String("schema", schemaName),
 	)
 
+	if jsonData != nil && len(*jsonData) == 0 {
+		jsonData = nil
+	}
+
 	doc := &entities.Document{
 		Name:     name,
 		OwnerID:  userID,
@@ -64,8 +141,25 @@ func (s *DocumentService) Create(
 		Grant:    &grant,
 	}
 
+	if schemaName != "" {
+		schemaID, err := s.schemas.ResolveID(ctx, userID, schemaName)
+		if err != nil {
+			return nil, err
+		}
+		doc.SchemaID = &schemaID
+	}
+
+	if err := s.schemas.Validate(ctx, doc); err != nil {
+		logger.FromContext(ctx).Warn("Rejected document that failed validation",
+			zap.String("user_id", userID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
 	if err := s.docRepo.Create(ctx, doc); err != nil {
-		s.logger.Error("Failed to create document in repository",
+		logger.FromContext(ctx).Error("Failed to create document in repository",
 			zap.String("user_id", userID),
 			zap.String("name", name),
 			zap.Error(err),
@@ -73,54 +167,97 @@ func (s *DocumentService) Create(
 		return nil, errors.NewInternalError("failed to create document")
 	}
 
-	s.logger.Info("Document created successfully",
+	logger.FromContext(ctx).Info("Document created successfully",
 		zap.String("doc_id", doc.ID),
 		zap.String("user_id", userID),
 	)
 
+	s.committed(ctx, doc)
+
 	return doc, nil
 }
 
-func (s *DocumentService) GetByID(ctx context.Context, docID, userLogin string) (*entities.Document, error) {
-	s.logger.Debug("Getting document by ID",
+// GetByID returns the document if userLogin may read it. When projection is
+// set, the JSON body is reduced to the requested pointer or fields.
+func (s *DocumentService) GetByID(ctx context.Context, docID, userLogin string, projection *entities.JSONProjection) (_ *entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.GetByID", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	doc, err := s.getByID(ctx, docID, userLogin, projection)
+
+	action := entities.AuditActionDocumentView
+	if doc != nil && doc.IsFile && projection == nil {
+		action = entities.AuditActionDocumentDownload
+		s.webhooks.Publish(ctx, &entities.WebhookEvent{
+			Type:     entities.WebhookEventDocumentDownloaded,
+			Actor:    userLogin,
+			Document: entities.NewDocumentSummary(doc),
+		})
+	}
+	s.audit.RecordResultAsync(ctx, userLogin, action, entities.AuditTargetDocument, docID, err)
+
+	return doc, err
+}
+
+func (s *DocumentService) getByID(ctx context.Context, docID, userLogin string, projection *entities.JSONProjection) (*entities.Document, error) {
+	log := logger.FromContext(ctx)
+
+	log.Debug("Getting document by ID",
 		zap.String("doc_id", docID),
 		zap.String("user_login", userLogin),
 	)
 
-	if doc, err := s.cache.GetDocument(ctx, docID); err == nil {
-		s.logger.Debug("Document found in cache",
+	if doc, fresh, err := s.cache.GetDocument(ctx, docID); err == nil {
+		log.Debug("Document found in cache",
 			zap.String("doc_id", docID),
+			zap.Bool("fresh", fresh),
 		)
 
+		if !fresh {
+			s.refreshDocument(ctx, docID)
+		}
+
 		if hasAccess, err := s.checkAccess(ctx, doc, userLogin); err != nil {
-			s.logger.Error("Failed to check access for cached document",
+			log.Error("Failed to check access for cached document",
 				zap.String("doc_id", docID),
 				zap.String("user_login", userLogin),
 				zap.Error(err),
 			)
 			return nil, errors.NewInternalError("failed to check access")
 		} else if !hasAccess {
-			s.logger.Warn("Access denied for cached document",
+			log.Warn("Access denied for cached document",
 				zap.String("doc_id", docID),
 				zap.String("user_login", userLogin),
 			)
 			return nil, errors.NewForbiddenError("access denied")
 		}
 
-		s.logger.Debug("Document access granted from cache",
+		log.Debug("Document access granted from cache",
 			zap.String("doc_id", docID),
 			zap.String("user_login", userLogin),
 		)
+
+		dropExpiredLocks(doc)
+
+		if projection != nil {
+			return s.projectDocument(doc, projection)
+		}
 		return doc, nil
 	}
 
-	s.logger.Debug("Document not found in cache, querying database",
+	log.Debug("Document not found in cache, querying database",
 		zap.String("doc_id", docID),
 	)
 
-	doc, err := s.docRepo.GetByID(ctx, docID)
+	var doc *entities.Document
+	var err error
+	if projection != nil {
+		doc, err = s.docRepo.GetByIDProjected(ctx, docID, projection)
+	} else {
+		doc, err = s.loadDocument(ctx, docID)
+	}
 	if err != nil {
-		s.logger.Error("Document not found in database",
+		log.Error("Document not found in database",
 			zap.String("doc_id", docID),
 			zap.Error(err),
 		)
@@ -129,7 +266,7 @@ func (s *DocumentService) GetByID(ctx context.Context, docID, userLogin string)
 
 	hasAccess, err := s.checkAccess(ctx, doc, userLogin)
 	if err != nil {
-		s.logger.Error("Failed to check access for document from database",
+		log.Error("Failed to check access for document from database",
 			zap.String("doc_id", docID),
 			zap.String("user_login", userLogin),
 			zap.Error(err),
@@ -137,64 +274,128 @@ func (s *DocumentService) GetByID(ctx context.Context, docID, userLogin string)
 		return nil, errors.NewInternalError("failed to check access")
 	}
 	if !hasAccess {
-		s.logger.Warn("Access denied for document from database",
+		log.Warn("Access denied for document from database",
 			zap.String("doc_id", docID),
 			zap.String("user_login", userLogin),
 		)
 		return nil, errors.NewForbiddenError("access denied")
 	}
 
-	s.logger.Info("Document retrieved successfully",
+	log.Info("Document retrieved successfully",
 		zap.String("doc_id", docID),
 		zap.String("user_login", userLogin),
 	)
 
-	go s.safeCacheOperation(func() {
-		cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := s.cache.SetDocument(cacheCtx, doc); err != nil {
-			s.logger.Error("Failed to cache document",
-				zap.String("doc_id", docID),
-				zap.Error(err),
-			)
-		} else {
-			s.logger.Debug("Document cached successfully",
-				zap.String("doc_id", docID),
-			)
-		}
-	})
+	if projection != nil && projection.Pointer != nil && doc.JSONData == nil {
+		return nil, errors.NewNotFoundError("no value at pointer")
+	}
 
 	return doc, nil
 }
 
-func (s *DocumentService) GetList(ctx context.Context, filter *entities.DocumentFilter) ([]*entities.Document, error) {
-	s.logger.Debug("Getting document list",
+// projectDocument applies a projection to a full document taken from the
+// cache, returning a copy so the cached value is left untouched.
+func (s *DocumentService) projectDocument(doc *entities.Document, projection *entities.JSONProjection) (*entities.Document, error) {
+	projected := *doc
+	projected.JSONData = nil
+
+	if doc.JSONData == nil {
+		if projection.Pointer != nil {
+			return nil, errors.NewNotFoundError("no value at pointer")
+		}
+		return &projected, nil
+	}
+
+	if projection.Pointer != nil {
+		value, err := jsonpatch.Extract(*doc.JSONData, projection.Pointer)
+		if err != nil {
+			if stdErrors.Is(err, jsonpatch.ErrInvalidPointer) {
+				return nil, errors.NewNotFoundError("no value at pointer")
+			}
+			return nil, errors.NewInternalError("failed to project document")
+		}
+		raw := json.RawMessage(value)
+		projected.JSONData = &raw
+		return &projected, nil
+	}
+
+	data, err := jsonpatch.Project(*doc.JSONData, projection.Fields)
+	if err != nil {
+		return nil, errors.NewInternalError("failed to project document")
+	}
+	raw := json.RawMessage(data)
+	projected.JSONData = &raw
+
+	return &projected, nil
+}
+
+// checkSearchMode validates the search mode and threshold of filter and
+// fills in the configured threshold when a similarity search sets none.
+func (s *DocumentService) checkSearchMode(filter *entities.DocumentFilter) error {
+	switch filter.Mode {
+	case entities.SearchModeExact:
+	case entities.SearchModeSimilar:
+		if filter.Threshold == nil {
+			threshold := s.similarityThreshold
+			filter.Threshold = &threshold
+		}
+		if *filter.Threshold < 0 || *filter.Threshold > 1 {
+			return errors.NewBadRequestError("threshold must be between 0 and 1")
+		}
+	default:
+		return errors.NewBadRequestError("unknown search mode")
+	}
+	return nil
+}
+
+func (s *DocumentService) GetList(ctx context.Context, filter *entities.DocumentFilter) (_ []*entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.GetList")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Getting document list",
 		zap.String("requesting_user", filter.RequestingUserLogin),
 		zap.Any("filter", filter),
 	)
 
 	if filter.RequestingUserLogin == "" {
-		s.logger.Warn("Document list requested without user login")
+		log.Warn("Document list requested without user login")
 		return nil, errors.NewForbiddenError("requesting user login is required")
 	}
 
-	cacheKey := s.cache.GetListCacheKey(filter)
+	if err := s.checkSearchMode(filter); err != nil {
+		return nil, err
+	}
 
-	if docs, err := s.cache.GetDocumentList(ctx, cacheKey); err == nil {
-		s.logger.Debug("Document list found in cache",
+	// The key is taken before querying, so a list read while a write lands is
+	// cached in the namespace that write retires.
+	cacheKey, err := s.cache.ListCacheKey(ctx, filter)
+	if stdErrors.Is(err, ErrCacheUnavailable) {
+		log.Debug("Cache unavailable, querying database",
+			zap.String("owner_id", filter.OwnerID),
+		)
+	} else if err != nil {
+		log.Warn("Failed to get list cache key, bypassing cache",
+			zap.String("owner_id", filter.OwnerID),
+			zap.Error(err),
+		)
+	} else if docs, err := s.cache.GetDocumentList(ctx, cacheKey); err == nil {
+		log.Debug("Document list found in cache",
 			zap.String("cache_key", cacheKey),
 			zap.Int("count", len(docs)),
 		)
+		dropExpiredLocks(docs...)
 		return docs, nil
 	}
 
-	s.logger.Debug("Document list not found in cache, querying database",
+	log.Debug("Document list not found in cache, querying database",
 		zap.String("cache_key", cacheKey),
 	)
 
 	docs, err := s.docRepo.GetByOwner(ctx, filter)
 	if err != nil {
-		s.logger.Error("Failed to get documents from database",
+		log.Error("Failed to get documents from database",
 			zap.String("requesting_user", filter.RequestingUserLogin),
 			zap.Error(err),
 		)
@@ -206,23 +407,26 @@ func (s *DocumentService) GetList(ctx context.Context, filter *entities.Document
 		return nil, errors.NewInternalError("failed to filter documents by access")
 	}
 
-	s.logger.Info("Document list retrieved successfully",
+	log.Info("Document list retrieved successfully",
 		zap.String("requesting_user", filter.RequestingUserLogin),
 		zap.Int("total_count", len(docs)),
 		zap.Int("filtered_count", len(filteredDocs)),
 	)
 
-	go s.safeCacheOperation(func() {
+	if cacheKey == "" {
+		return filteredDocs, nil
+	}
+
+	go s.safeCacheOperation(ctx, func() {
 		cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err := s.cache.SetDocumentList(cacheCtx, cacheKey, filteredDocs); err != nil {
-			s.logger.Error("Failed to cache document list",
+		if err := s.cache.SetDocumentList(cacheCtx, filter.OwnerID, cacheKey, filteredDocs); err != nil {
+			log.Error("Failed to cache document list",
 				zap.String("cache_key", cacheKey),
 				zap.Error(err),
 			)
-			log.Printf("Failed to cache document list: %v", err)
 		} else {
-			s.logger.Debug("Document list cached successfully",
+			log.Debug("Document list cached successfully",
 				zap.String("cache_key", cacheKey),
 				zap.Int("count", len(filteredDocs)),
 			)
@@ -232,106 +436,577 @@ func (s *DocumentService) GetList(ctx context.Context, filter *entities.Document
 	return filteredDocs, nil
 }
 
-func (s *DocumentService) Delete(ctx context.Context, docID, userID string) error {
-	s.logger.Debug("Deleting document",
-		zap.String("doc_id", docID),
-		zap.String("user_id", userID),
+// Aggregate groups the documents matched by filter. groupBy is one of
+// "json.<path>", "mime", "owner" or "created_at:<day|week|month|year>";
+// metric is count, sum, avg, min or max, the latter four over the numeric JSON
+// value at field ("json.<path>").
+func (s *DocumentService) Aggregate(ctx context.Context, filter *entities.DocumentFilter, groupBy, metric, field string) (_ []*entities.AggregateBucket, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Aggregate")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Aggregating documents",
+		zap.String("requesting_user", filter.RequestingUserLogin),
+		zap.String("group_by", groupBy),
+		zap.String("metric", metric),
+		zap.String("field", field),
 	)
 
-	doc, err := s.docRepo.GetByID(ctx, docID)
+	if filter.RequestingUserLogin == "" {
+		return nil, errors.NewForbiddenError("requesting user login is required")
+	}
+
+	if err := s.checkSearchMode(filter); err != nil {
+		return nil, err
+	}
+
+	query := &entities.AggregateQuery{
+		Filter: *filter,
+		Metric: metric,
+	}
+
+	switch {
+	case strings.HasPrefix(groupBy, "json."):
+		path, err := parseJSONFieldPath(groupBy)
+		if err != nil {
+			return nil, err
+		}
+		query.GroupBy = entities.GroupByJSON
+		query.GroupPath = path
+	case groupBy == entities.GroupByMIME, groupBy == entities.GroupByOwner:
+		query.GroupBy = groupBy
+	case groupBy == entities.GroupByCreatedAt || strings.HasPrefix(groupBy, entities.GroupByCreatedAt+":"):
+		bucket := strings.TrimPrefix(strings.TrimPrefix(groupBy, entities.GroupByCreatedAt), ":")
+		if bucket == "" {
+			bucket = "day"
+		}
+		if !slices.Contains([]string{"day", "week", "month", "year"}, bucket) {
+			return nil, errors.NewBadRequestError("created_at bucket must be day, week, month or year")
+		}
+		query.GroupBy = entities.GroupByCreatedAt
+		query.Bucket = bucket
+	default:
+		return nil, errors.NewBadRequestError("group_by must be json.<path>, mime, owner or created_at:<bucket>")
+	}
+
+	switch metric {
+	case entities.AggregateCount:
+	case entities.AggregateSum, entities.AggregateAvg, entities.AggregateMin, entities.AggregateMax:
+		path, err := parseJSONFieldPath(field)
+		if err != nil {
+			return nil, err
+		}
+		query.Field = path
+	default:
+		return nil, errors.NewBadRequestError("metric must be count, sum, avg, min or max")
+	}
+
+	buckets, err := s.docRepo.Aggregate(ctx, query)
 	if err != nil {
-		s.logger.Error("Document not found for deletion",
-			zap.String("doc_id", docID),
+		log.Error("Failed to aggregate documents",
+			zap.String("requesting_user", filter.RequestingUserLogin),
+			zap.String("group_by", groupBy),
+			zap.String("metric", metric),
 			zap.Error(err),
 		)
-		return errors.NewNotFoundError("document not found")
+		return nil, errors.NewInternalError("failed to aggregate documents")
 	}
 
-	if doc.OwnerID != userID {
-		s.logger.Warn("User attempted to delete document they don't own",
-			zap.String("doc_id", docID),
-			zap.String("user_id", userID),
-			zap.String("owner_id", doc.OwnerID),
-		)
-		return errors.NewForbiddenError("access denied")
+	log.Info("Documents aggregated successfully",
+		zap.String("requesting_user", filter.RequestingUserLogin),
+		zap.String("group_by", groupBy),
+		zap.String("metric", metric),
+		zap.Int("buckets", len(buckets)),
+	)
+
+	return buckets, nil
+}
+
+// parseJSONFieldPath parses a "json.a.b" reference to a JSON body field.
+func parseJSONFieldPath(field string) (jsonpatch.Pointer, error) {
+	if !strings.HasPrefix(field, "json.") {
+		return nil, errors.NewBadRequestError("field must be a json.<path> reference")
 	}
 
-	if err := s.docRepo.Delete(ctx, docID); err != nil {
-		s.logger.Error("Failed to delete document from database",
-			zap.String("doc_id", docID),
-			zap.Error(err),
-		)
-		return errors.NewInternalError("failed to delete document")
+	paths, err := jsonpatch.ParseFields(strings.TrimPrefix(field, "json."))
+	if err != nil || len(paths) != 1 {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("invalid field path %q", field))
+	}
+
+	return paths[0], nil
+}
+
+func (s *DocumentService) SuggestNames(ctx context.Context, user *entities.User, query string, limit int) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.SuggestNames")
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Suggesting document names",
+		zap.String("user_login", user.Login),
+		zap.String("query", query),
+		zap.Int("limit", limit),
+	)
+
+	if query == "" {
+		return nil, errors.NewBadRequestError("query is required")
 	}
 
-	user, err := s.userRepo.GetByID(ctx, userID)
+	if limit <= 0 || limit > s.suggestLimit {
+		limit = s.suggestLimit
+	}
+
+	names, err := s.docRepo.SuggestNames(ctx, &entities.SuggestFilter{
+		UserID:    user.ID,
+		UserLogin: user.Login,
+		Query:     query,
+		Threshold: s.similarityThreshold,
+		Limit:     limit,
+	})
 	if err != nil {
-		s.logger.Error("Failed to get user for cache invalidation",
-			zap.String("user_id", userID),
+		log.Error("Failed to suggest document names",
+			zap.String("user_login", user.Login),
+			zap.String("query", query),
 			zap.Error(err),
 		)
+		return nil, errors.NewInternalError("failed to suggest document names")
 	}
 
-	s.logger.Info("Document deleted successfully",
+	return names, nil
+}
+
+// PatchJSON applies a JSON Patch or JSON Merge Patch to the document body.
+// With an ifMatch set the patch fails with PreconditionFailed if the document
+// is at none of its versions; without one, concurrent writes are retried.
+func (s *DocumentService) PatchJSON(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch, contentType string, patch []byte) (_ *entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.PatchJSON", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	doc, err := s.patchJSON(ctx, docID, user, ifMatch, contentType, patch)
+	s.audit.RecordResult(ctx, user.Login, entities.AuditActionDocumentUpdate, entities.AuditTargetDocument, docID, err)
+	return doc, err
+}
+
+func (s *DocumentService) patchJSON(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch, contentType string, patch []byte) (*entities.Document, error) {
+	log := logger.FromContext(ctx)
+
+	log.Debug("Patching document",
 		zap.String("doc_id", docID),
-		zap.String("user_id", userID),
+		zap.String("user_id", user.ID),
+		zap.Int64s("if_match", ifMatch),
+		zap.String("content_type", contentType),
+		zap.Int("patch_size", len(patch)),
 	)
 
-	go s.safeCacheOperation(func() {
-		cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	var apply func(doc []byte) ([]byte, error)
+	switch contentType {
+	case ContentTypeJSONPatch:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, errors.NewBadRequestError(err.Error())
+		}
+		apply = ops.Apply
+	case ContentTypeMergePatch:
+		apply = func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, patch)
+		}
+	default:
+		return nil, errors.NewBadRequestError("unsupported patch content type")
+	}
+
+	for attempt := 1; attempt <= maxPatchAttempts; attempt++ {
+		doc, err := s.getWritableDocument(ctx, docID, user, ifMatch)
+		if err != nil {
+			return nil, err
+		}
+		if doc.IsFile {
+			return nil, errors.NewUnprocessableEntityError("file documents have no JSON content to patch")
+		}
+
+		var current []byte
+		if doc.JSONData != nil {
+			current = *doc.JSONData
+		}
 
-		if err := s.cache.InvalidateDocument(cacheCtx, docID); err != nil {
-			s.logger.Error("Failed to invalidate document cache",
+		patched, err := apply(current)
+		if err != nil {
+			log.Warn("Failed to apply patch",
 				zap.String("doc_id", docID),
 				zap.Error(err),
 			)
-		} else {
-			s.logger.Debug("Document cache invalidated",
+			return nil, patchError(err)
+		}
+
+		data := json.RawMessage(patched)
+		candidate := *doc
+		candidate.JSONData = &data
+		if err := s.schemas.Validate(ctx, &candidate); err != nil {
+			log.Warn("Patched document failed validation",
 				zap.String("doc_id", docID),
+				zap.Error(err),
 			)
+			return nil, err
 		}
 
-		if user != nil {
-			if err := s.cache.InvalidateUserLists(cacheCtx, user.Login); err != nil {
-				s.logger.Error("Failed to invalidate user lists",
-					zap.String("user_login", user.Login),
-					zap.Error(err),
-				)
-			} else {
-				s.logger.Debug("User lists cache invalidated",
-					zap.String("user_login", user.Login),
+		updated, err := s.docRepo.UpdateJSON(ctx, docID, &data, writeCondition(doc, user))
+		if err != nil {
+			switch err.(type) {
+			case *errors.NotFoundError, *errors.LockedError:
+				return nil, err
+			}
+			if _, ok := err.(*errors.PreconditionFailedError); ok {
+				if ifMatch != nil {
+					return nil, err
+				}
+				log.Debug("Concurrent modification while patching, retrying",
+					zap.String("doc_id", docID),
+					zap.Int("attempt", attempt),
 				)
+				continue
 			}
+			log.Error("Failed to update document json",
+				zap.String("doc_id", docID),
+				zap.Error(err),
+			)
+			return nil, errors.NewInternalError("failed to patch document")
 		}
 
-		if doc.Grant != nil {
-			for _, grantUserLogin := range *doc.Grant {
-				if err := s.cache.InvalidateUserLists(cacheCtx, grantUserLogin); err != nil {
-					s.logger.Error("Failed to invalidate user lists for granted user",
-						zap.String("granted_user_login", grantUserLogin),
-						zap.Error(err),
-					)
-				} else {
-					s.logger.Debug("Granted user lists cache invalidated",
-						zap.String("granted_user_login", grantUserLogin),
-					)
-				}
+		log.Info("Document patched successfully",
+			zap.String("doc_id", docID),
+			zap.String("user_id", user.ID),
+			zap.Int("attempt", attempt),
+		)
+
+		s.committed(ctx, updated)
+
+		return updated, nil
+	}
+
+	log.Warn("Giving up on patch after repeated concurrent modifications",
+		zap.String("doc_id", docID),
+		zap.Int("attempts", maxPatchAttempts),
+	)
+	return nil, errors.NewConflictError("document is being modified concurrently")
+}
+
+// Update replaces the name, MIME type and content of a document. Nil
+// arguments keep the current value. A replaced file is removed from storage
+// once the new version is committed.
+func (s *DocumentService) Update(
+	ctx context.Context,
+	docID string,
+	user *entities.User,
+	ifMatch entities.VersionMatch,
+	name, mime, schemaName *string,
+	filePath *string,
+	jsonData *json.RawMessage,
+) (_ *entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Update", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	doc, err := s.update(ctx, docID, user, ifMatch, name, mime, schemaName, filePath, jsonData)
+	s.audit.RecordResult(ctx, user.Login, entities.AuditActionDocumentUpdate, entities.AuditTargetDocument, docID, err)
+	return doc, err
+}
+
+func (s *DocumentService) update(
+	ctx context.Context,
+	docID string,
+	user *entities.User,
+	ifMatch entities.VersionMatch,
+	name, mime, schemaName *string,
+	filePath *string,
+	jsonData *json.RawMessage,
+) (*entities.Document, error) {
+	logger.FromContext(ctx).Debug("Updating document",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+		zap.Int64s("if_match", ifMatch),
+		zap.Bool("replace_file", filePath != nil),
+		zap.Bool("replace_json", jsonData != nil),
+	)
+
+	doc, err := s.getWritableDocument(ctx, docID, user, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	oldFilePath := doc.FilePath
+	updated := *doc
+	if name != nil && *name != "" {
+		updated.Name = *name
+	}
+	if mime != nil {
+		updated.MIME = *mime
+	}
+	if filePath != nil {
+		updated.FilePath = filePath
+	}
+	if jsonData != nil {
+		updated.JSONData = jsonData
+	}
+	if schemaName != nil {
+		updated.SchemaID = nil
+		if *schemaName != "" {
+			schemaID, err := s.schemas.ResolveID(ctx, doc.OwnerID, *schemaName)
+			if err != nil {
+				return nil, err
 			}
+			updated.SchemaID = &schemaID
 		}
-	})
+	}
+
+	if err := s.schemas.Validate(ctx, &updated); err != nil {
+		logger.FromContext(ctx).Warn("Updated document failed validation",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := s.docRepo.UpdateContent(ctx, &updated, writeCondition(doc, user)); err != nil {
+		switch err.(type) {
+		case *errors.NotFoundError, *errors.PreconditionFailedError, *errors.LockedError:
+			return nil, err
+		}
+		logger.FromContext(ctx).Error("Failed to update document in repository",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to update document")
+	}
+
+	if filePath != nil && oldFilePath != nil && *oldFilePath != *filePath {
+		if err := os.Remove(*oldFilePath); err != nil && !os.IsNotExist(err) {
+			logger.FromContext(ctx).Warn("Failed to remove replaced file",
+				zap.String("doc_id", docID),
+				zap.String("file_path", *oldFilePath),
+				zap.Error(err),
+			)
+		}
+	}
+
+	logger.FromContext(ctx).Info("Document updated successfully",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+		zap.Int64("version", updated.Version),
+	)
+
+	s.committed(ctx, &updated)
+
+	return &updated, nil
+}
+
+// UpdateAccess changes who can see a document. A nil isPublic keeps the
+// current public flag. Users removed from the grant list lose their cached
+// lists as well as those added to it.
+func (s *DocumentService) UpdateAccess(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch, isPublic *bool, grant []string) (_ *entities.Document, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.UpdateAccess", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	doc, err := s.updateAccess(ctx, docID, user, ifMatch, isPublic, grant)
+	s.audit.RecordResult(ctx, user.Login, entities.AuditActionDocumentShare, entities.AuditTargetDocument, docID, err)
+	return doc, err
+}
+
+func (s *DocumentService) updateAccess(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch, isPublic *bool, grant []string) (*entities.Document, error) {
+	log := logger.FromContext(ctx)
+
+	log.Debug("Updating document access",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+		zap.Int64s("if_match", ifMatch),
+		zap.Strings("grant", grant),
+	)
+
+	doc, err := s.getWritableDocument(ctx, docID, user, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	public := doc.IsPublic
+	if isPublic != nil {
+		public = *isPublic
+	}
+	if grant == nil {
+		grant = []string{}
+	}
+
+	updated, err := s.docRepo.UpdateAccess(ctx, docID, public, grant, writeCondition(doc, user))
+	if err != nil {
+		switch err.(type) {
+		case *errors.NotFoundError, *errors.PreconditionFailedError, *errors.LockedError:
+			return nil, err
+		}
+		log.Error("Failed to update document access in repository",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to update document access")
+	}
+
+	log.Info("Document access updated successfully",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+		zap.Bool("public", updated.IsPublic),
+		zap.Strings("grant", grant),
+	)
+
+	s.committed(ctx, updated)
+
+	return updated, nil
+}
+
+// getWritableDocument loads a document for modification by user. Only the
+// owner may modify a document; a lock held by someone else rejects the write
+// without granting its holder any rights. A non-nil ifMatch is checked up
+// front so stale writers fail before doing any work; the repository checks
+// lock and version again atomically.
+func (s *DocumentService) getWritableDocument(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch) (*entities.Document, error) {
+	log := logger.FromContext(ctx)
+
+	doc, err := s.docRepo.GetByID(ctx, docID)
+	if err != nil {
+		log.Error("Document not found for modification",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return nil, errors.NewNotFoundError("document not found")
+	}
+
+	if doc.OwnerID != user.ID {
+		log.Warn("User attempted to modify document they don't own",
+			zap.String("doc_id", docID),
+			zap.String("user_id", user.ID),
+			zap.String("owner_id", doc.OwnerID),
+		)
+		return nil, errors.NewForbiddenError("access denied")
+	}
+
+	// The repository returns only live locks, judged by the database clock.
+	if lock := doc.Lock; lock != nil && lock.Holder != user.Login {
+		log.Debug("Document is locked by another user",
+			zap.String("doc_id", docID),
+			zap.String("user_login", user.Login),
+			zap.String("lock_holder", lock.Holder),
+		)
+		return nil, errors.NewLockedError(fmt.Sprintf("document is locked by %s", lock.Holder))
+	}
+
+	if !ifMatch.Matches(doc.Version) {
+		log.Debug("Document version mismatch",
+			zap.String("doc_id", docID),
+			zap.Int64s("if_match", ifMatch),
+			zap.Int64("version", doc.Version),
+		)
+		return nil, errors.NewPreconditionFailedError("document version does not match")
+	}
+
+	return doc, nil
+}
+
+// writeCondition makes a write by user conditional on doc being unchanged
+// since it was loaded.
+func writeCondition(doc *entities.Document, user *entities.User) entities.WriteCondition {
+	return entities.WriteCondition{ExpectedVersion: doc.Version, Actor: user.Login}
+}
 
+func patchError(err error) error {
+	switch {
+	case stdErrors.Is(err, jsonpatch.ErrTestFailed):
+		return errors.NewConflictError(err.Error())
+	case stdErrors.Is(err, jsonpatch.ErrInvalidPointer):
+		return errors.NewUnprocessableEntityError(err.Error())
+	default:
+		return errors.NewBadRequestError(err.Error())
+	}
+}
+
+func (s *DocumentService) Delete(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch) (err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Delete", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	err = s.delete(ctx, docID, user, ifMatch)
+	s.audit.RecordResult(ctx, user.Login, entities.AuditActionDocumentDelete, entities.AuditTargetDocument, docID, err)
+	return err
+}
+
+func (s *DocumentService) delete(ctx context.Context, docID string, user *entities.User, ifMatch entities.VersionMatch) error {
+	log := logger.FromContext(ctx)
+
+	log.Debug("Deleting document",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+		zap.Int64s("if_match", ifMatch),
+	)
+
+	doc, err := s.getWritableDocument(ctx, docID, user, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	if err := s.docRepo.Delete(ctx, docID, writeCondition(doc, user)); err != nil {
+		switch err.(type) {
+		case *errors.NotFoundError, *errors.PreconditionFailedError, *errors.LockedError:
+			return err
+		}
+		log.Error("Failed to delete document from database",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return errors.NewInternalError("failed to delete document")
+	}
+
+	log.Info("Document deleted successfully",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+	)
+
+	s.committed(ctx, doc)
+
+	return nil
+}
+
+// invalidateCaches drops the cached document and retires the cached lists
+// of its owner.
+func (s *DocumentService) invalidateCaches(ctx context.Context, docID, ownerID string) error {
+	if err := s.cache.InvalidateDocument(ctx, docID); err != nil {
+		return fmt.Errorf("invalidate document cache: %w", err)
+	}
+	if err := s.cache.InvalidateOwnerLists(ctx, ownerID); err != nil {
+		return fmt.Errorf("invalidate lists of owner %s: %w", ownerID, err)
+	}
+
+	logger.FromContext(ctx).Debug("Document caches invalidated",
+		zap.String("doc_id", docID),
+		zap.String("owner_id", ownerID),
+	)
 	return nil
 }
 
+// committed runs after a document write commits. It invalidates the caches
+// right away, so the writer reads their own write, and wakes the outbox
+// relay, which invalidates them again should this fail and applies the
+// other side effects.
+func (s *DocumentService) committed(ctx context.Context, doc *entities.Document) {
+	if err := s.invalidateCaches(ctx, doc.ID, doc.OwnerID); err != nil {
+		logger.FromContext(ctx).Warn("Failed to invalidate caches, leaving it to the outbox",
+			zap.String("doc_id", doc.ID),
+			zap.Error(err),
+		)
+	}
+	s.outbox.Notify()
+}
+
 func (s *DocumentService) checkAccess(ctx context.Context, doc *entities.Document, userLogin string) (bool, error) {
 	if doc.IsPublic {
 		return true, nil
 	}
 
-	user, err := s.userRepo.GetByLogin(ctx, userLogin)
+	user, err := s.users.UserByLogin(ctx, userLogin)
 	if err != nil {
-		s.logger.Error("Failed to get user for access check",
+		logger.FromContext(ctx).Error("Failed to get user for access check",
 			zap.String("user_login", userLogin),
 			zap.Error(err),
 		)
@@ -350,9 +1025,17 @@ func (s *DocumentService) checkAccess(ctx context.Context, doc *entities.Documen
 }
 
 func (s *DocumentService) filterDocumentsWithAccess(ctx context.Context, docs []*entities.Document, userLogin string) ([]*entities.Document, error) {
-	numWorkers := runtime.NumCPU() / 2
+	numWorkers := max(runtime.NumCPU()/2, 1)
 
-	s.logger.Debug("Filtering documents with access",
+	ctx, span := startSpan(ctx, "DocumentService.filterDocumentsWithAccess",
+		attribute.Int("docs", len(docs)),
+		attribute.Int("workers", numWorkers),
+	)
+	defer span.End()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Filtering documents with access",
 		zap.String("user_login", userLogin),
 		zap.Int("total_docs", len(docs)),
 		zap.Int("workers", numWorkers),
@@ -371,7 +1054,7 @@ func (s *DocumentService) filterDocumentsWithAccess(ctx context.Context, docs []
 			defer wg.Done()
 			for doc := range jobs {
 				if hasAccess, err := s.checkAccess(ctx, doc, userLogin); err != nil {
-					s.logger.Error("Error checking access for document",
+					log.Error("Error checking access for document",
 						zap.String("doc_id", doc.ID),
 						zap.Int("worker_id", workerID),
 					)
@@ -407,7 +1090,7 @@ func (s *DocumentService) filterDocumentsWithAccess(ctx context.Context, docs []
 		filteredDocs = append(filteredDocs, doc)
 	}
 
-	s.logger.Debug("Document filtering completed",
+	log.Debug("Document filtering completed",
 		zap.String("user_login", userLogin),
 		zap.Int("filtered_count", len(filteredDocs)),
 	)
@@ -415,13 +1098,49 @@ func (s *DocumentService) filterDocumentsWithAccess(ctx context.Context, docs []
 	return filteredDocs, nil
 }
 
-func (s *DocumentService) safeCacheOperation(operation func()) {
+func (s *DocumentService) safeCacheOperation(ctx context.Context, operation func()) {
 	defer func() {
 		if r := recover(); r != nil {
-			s.logger.Error("Panic in cache operation",
+			logger.FromContext(ctx).Error("Panic in cache operation",
 				zap.Any("panic", r),
 			)
 		}
 	}()
 	operation()
 }
+
+// Activity returns the audit trail of a document. Only its owner may see it.
+func (s *DocumentService) Activity(ctx context.Context, docID string, user *entities.User, filter *entities.AuditFilter) (_ []*entities.AuditEvent, err error) {
+	ctx, span := startSpan(ctx, "DocumentService.Activity", attribute.String("doc.id", docID))
+	defer func() { endSpan(span, err) }()
+
+	log := logger.FromContext(ctx)
+
+	log.Debug("Getting document activity",
+		zap.String("doc_id", docID),
+		zap.String("user_id", user.ID),
+	)
+
+	doc, err := s.docRepo.GetByID(ctx, docID)
+	if err != nil {
+		log.Error("Document not found for activity",
+			zap.String("doc_id", docID),
+			zap.Error(err),
+		)
+		return nil, errors.NewNotFoundError("document not found")
+	}
+
+	if doc.OwnerID != user.ID {
+		log.Warn("User attempted to read activity of document they don't own",
+			zap.String("doc_id", docID),
+			zap.String("user_id", user.ID),
+			zap.String("owner_id", doc.OwnerID),
+		)
+		return nil, errors.NewForbiddenError("access denied")
+	}
+
+	filter.TargetType = entities.AuditTargetDocument
+	filter.TargetID = docID
+
+	return s.audit.List(ctx, filter)
+}
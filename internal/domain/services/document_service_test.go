@@ -0,0 +1,489 @@
+package services_test
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/internal/domain/services"
+	"document-server/internal/infrastructure/cache"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// memoryDocuments is a DocumentRepository holding documents in memory. It
+// counts list queries, so tests can tell cached lists from fresh ones.
+type memoryDocuments struct {
+	repositories.DocumentRepository
+
+	mu      sync.Mutex
+	docs    map[string]*entities.Document
+	nextID  int
+	queries atomic.Int64
+}
+
+func newMemoryDocuments() *memoryDocuments {
+	return &memoryDocuments{docs: make(map[string]*entities.Document)}
+}
+
+func (r *memoryDocuments) Create(ctx context.Context, doc *entities.Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	doc.ID = fmt.Sprintf("doc-%d", r.nextID)
+	doc.Version = 1
+	stored := *doc
+	r.docs[doc.ID] = &stored
+	return nil
+}
+
+func (r *memoryDocuments) GetByID(ctx context.Context, id string) (*entities.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.docs[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("document not found")
+	}
+	found := *doc
+	return &found, nil
+}
+
+func (r *memoryDocuments) GetByOwner(ctx context.Context, filter *entities.DocumentFilter) ([]*entities.Document, error) {
+	r.queries.Add(1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var docs []*entities.Document
+	for _, doc := range r.docs {
+		if doc.OwnerID == filter.OwnerID {
+			found := *doc
+			docs = append(docs, &found)
+		}
+	}
+	return docs, nil
+}
+
+func (r *memoryDocuments) UpdateContent(ctx context.Context, doc *entities.Document, cond entities.WriteCondition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[doc.ID]
+	if !ok {
+		return errors.NewNotFoundError("document not found")
+	}
+	if stored.Version != cond.ExpectedVersion {
+		return errors.NewPreconditionFailedError("document version does not match")
+	}
+	doc.Version = stored.Version + 1
+	updated := *doc
+	r.docs[doc.ID] = &updated
+	return nil
+}
+
+func (r *memoryDocuments) UpdateAccess(ctx context.Context, id string, isPublic bool, grant []string, cond entities.WriteCondition) (*entities.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("document not found")
+	}
+	if stored.Version != cond.ExpectedVersion {
+		return nil, errors.NewPreconditionFailedError("document version does not match")
+	}
+	updated := *stored
+	updated.IsPublic = isPublic
+	updated.Grant = &grant
+	updated.Version++
+	r.docs[id] = &updated
+	found := updated
+	return &found, nil
+}
+
+func (r *memoryDocuments) Delete(ctx context.Context, id string, cond entities.WriteCondition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[id]
+	if !ok {
+		return errors.NewNotFoundError("document not found")
+	}
+	if stored.Version != cond.ExpectedVersion {
+		return errors.NewPreconditionFailedError("document version does not match")
+	}
+	delete(r.docs, id)
+	return nil
+}
+
+func (r *memoryDocuments) AcquireLock(ctx context.Context, id, holder string, ttl time.Duration) (*entities.Document, error) {
+	return r.setLock(id, &entities.DocumentLock{Holder: holder, AcquiredAt: time.Now(), ExpiresAt: time.Now().Add(ttl)})
+}
+
+func (r *memoryDocuments) ReleaseLock(ctx context.Context, id, holder string, force bool) (*entities.Document, error) {
+	return r.setLock(id, nil)
+}
+
+func (r *memoryDocuments) setLock(id string, lock *entities.DocumentLock) (*entities.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[id]
+	if !ok {
+		return nil, errors.NewNotFoundError("document not found")
+	}
+	stored.Lock = lock
+	found := *stored
+	return &found, nil
+}
+
+type memoryUsers struct {
+	repositories.UserRepository
+	users []*entities.User
+}
+
+func (r *memoryUsers) GetByLogin(ctx context.Context, login string) (*entities.User, error) {
+	for _, user := range r.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("user not found")
+}
+
+func (r *memoryUsers) GetByID(ctx context.Context, id string) (*entities.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, errors.NewNotFoundError("user not found")
+}
+
+type noSchemas struct {
+	repositories.SchemaRepository
+}
+
+func (noSchemas) ListByOwner(ctx context.Context, ownerID string) ([]*entities.JSONSchema, error) {
+	return nil, nil
+}
+
+type discardAudit struct {
+	repositories.AuditRepository
+}
+
+func (discardAudit) Create(ctx context.Context, event *entities.AuditEvent) error {
+	return nil
+}
+
+func (discardAudit) CreateBatch(ctx context.Context, events []*entities.AuditEvent) error {
+	return nil
+}
+
+// documentFixture is a DocumentService backed by in-memory repositories and
+// the Redis cache service over an in-memory Redis. Owner's documents are
+// listed either by owner or by other, who sees only those shared with them.
+type documentFixture struct {
+	svc   *services.DocumentService
+	docs  *memoryDocuments
+	cache services.CacheService
+	owner *entities.User
+	other *entities.User
+}
+
+func newDocumentFixture() *documentFixture {
+	owner := &entities.User{ID: "user-1", Login: "alice"}
+	other := &entities.User{ID: "user-2", Login: "bob"}
+	memory := cache.NewMemoryCache()
+	cacheSvc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+	docs := newMemoryDocuments()
+
+	svc := services.NewDocumentService(
+		docs,
+		services.NewUserResolver(&memoryUsers{users: []*entities.User{owner, other}}, nil, cacheSvc),
+		cacheSvc,
+		services.NewSchemaService(noSchemas{}),
+		services.NewAuditService(discardAudit{}, 0, nil),
+		services.NewWebhookService(nil, services.WebhookOptions{}),
+		services.NewEventService(memory, 0),
+		services.NewOutboxService(nil, services.OutboxOptions{}),
+		0.3, 10, time.Minute, time.Hour,
+	)
+
+	return &documentFixture{svc: svc, docs: docs, cache: cacheSvc, owner: owner, other: other}
+}
+
+// filter selects the owner's documents as seen by viewer.
+func (f *documentFixture) filter(viewer *entities.User) *entities.DocumentFilter {
+	return &entities.DocumentFilter{OwnerID: f.owner.ID, RequestingUserLogin: viewer.Login}
+}
+
+func (f *documentFixture) create(t *testing.T, name, content string) *entities.Document {
+	t.Helper()
+
+	data := json.RawMessage(content)
+	doc, err := f.svc.Create(context.Background(), f.owner, name, "application/json", false, false, nil, &data, nil, "")
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return doc
+}
+
+// list returns the owner's list as seen by viewer, by document name and JSON
+// content.
+func (f *documentFixture) list(t *testing.T, viewer *entities.User) map[string]string {
+	t.Helper()
+
+	docs, err := f.svc.GetList(context.Background(), f.filter(viewer))
+	if err != nil {
+		t.Fatalf("get list: %v", err)
+	}
+
+	listed := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		listed[doc.Name] = string(*doc.JSONData)
+	}
+	return listed
+}
+
+// waitListCached waits for the list GetList caches in the background, so the
+// next read is served from the cache unless a write retired it.
+func (f *documentFixture) waitListCached(t *testing.T, viewer *entities.User) {
+	t.Helper()
+
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		key, err := f.cache.ListCacheKey(ctx, f.filter(viewer))
+		if err != nil {
+			t.Fatalf("list cache key: %v", err)
+		}
+		if _, err := f.cache.GetDocumentList(ctx, key); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("list was not cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readCachedList lists the owner's documents as seen by viewer, waits for
+// the list to be cached and checks a second read is served from the cache.
+func (f *documentFixture) readCachedList(t *testing.T, viewer *entities.User) map[string]string {
+	t.Helper()
+
+	listed := f.list(t, viewer)
+	f.waitListCached(t, viewer)
+
+	queries := f.docs.queries.Load()
+	f.list(t, viewer)
+	if got := f.docs.queries.Load(); got != queries {
+		t.Fatalf("cached list queried the database")
+	}
+	return listed
+}
+
+func TestDocumentServiceListReadsYourWrites(t *testing.T) {
+	f := newDocumentFixture()
+	ctx := context.Background()
+
+	a := f.create(t, "a.json", `{"n":1}`)
+	if listed := f.readCachedList(t, f.owner); len(listed) != 1 || listed["a.json"] != `{"n":1}` {
+		t.Fatalf("list after first create = %v", listed)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		f.create(t, "b.json", `{"n":2}`)
+		if listed := f.list(t, f.owner); listed["b.json"] != `{"n":2}` {
+			t.Fatalf("list right after create = %v, want b.json", listed)
+		}
+		f.readCachedList(t, f.owner)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		data := json.RawMessage(`{"n":10}`)
+		if _, err := f.svc.Update(ctx, a.ID, f.owner, nil, nil, nil, nil, nil, &data); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if listed := f.list(t, f.owner); listed["a.json"] != `{"n":10}` {
+			t.Fatalf("list right after update = %v, want updated a.json", listed)
+		}
+		f.readCachedList(t, f.owner)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		docs, err := f.svc.GetList(ctx, f.filter(f.owner))
+		if err != nil {
+			t.Fatalf("get list: %v", err)
+		}
+		i := slices.IndexFunc(docs, func(doc *entities.Document) bool { return doc.Name == "b.json" })
+		if i < 0 {
+			t.Fatalf("b.json missing from list before delete")
+		}
+		if err := f.svc.Delete(ctx, docs[i].ID, f.owner, nil); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if listed := f.list(t, f.owner); len(listed) != 1 || listed["b.json"] != "" {
+			t.Fatalf("list right after delete = %v, want only a.json", listed)
+		}
+	})
+}
+
+func TestDocumentServiceListFollowsAccessChanges(t *testing.T) {
+	f := newDocumentFixture()
+	ctx := context.Background()
+
+	doc := f.create(t, "a.json", `{"n":1}`)
+	if listed := f.readCachedList(t, f.other); len(listed) != 0 {
+		t.Fatalf("list of %s before sharing = %v, want empty", f.other.Login, listed)
+	}
+
+	public, private := true, false
+	steps := []struct {
+		name     string
+		isPublic *bool
+		grant    []string
+		visible  bool
+	}{
+		{"grant", nil, []string{f.other.Login}, true},
+		{"revoke", nil, nil, false},
+		{"make public", &public, nil, true},
+		{"make private", &private, nil, false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if _, err := f.svc.UpdateAccess(ctx, doc.ID, f.owner, nil, step.isPublic, step.grant); err != nil {
+				t.Fatalf("update access: %v", err)
+			}
+			if listed := f.list(t, f.other); (listed["a.json"] != "") != step.visible {
+				t.Fatalf("list of %s right after %s = %v, want a.json visible %v", f.other.Login, step.name, listed, step.visible)
+			}
+			f.readCachedList(t, f.other)
+		})
+	}
+}
+
+func TestDocumentServiceGetByIDReadsYourWrites(t *testing.T) {
+	f := newDocumentFixture()
+	ctx := context.Background()
+
+	doc := f.create(t, "a.json", `{"n":1}`)
+	if _, err := f.svc.GetByID(ctx, doc.ID, f.owner.Login, nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, _, err := f.cache.GetDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("document was not cached: %v", err)
+	}
+
+	data := json.RawMessage(`{"n":2}`)
+	if _, err := f.svc.Update(ctx, doc.ID, f.owner, nil, nil, nil, nil, nil, &data); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	got, err := f.svc.GetByID(ctx, doc.ID, f.owner.Login, nil)
+	if err != nil {
+		t.Fatalf("get after update: %v", err)
+	}
+	if string(*got.JSONData) != `{"n":2}` {
+		t.Fatalf("get right after update = %s, want the update", *got.JSONData)
+	}
+}
+
+func isBadRequest(err error) bool {
+	var badRequest *errors.BadRequestError
+	return stdErrors.As(err, &badRequest)
+}
+
+func TestDocumentServiceSearchThreshold(t *testing.T) {
+	f := newDocumentFixture()
+	ctx := context.Background()
+
+	for _, threshold := range []float64{-0.1, 1.5} {
+		filter := f.filter(f.owner)
+		filter.Mode = entities.SearchModeSimilar
+		filter.Threshold = &threshold
+		if _, err := f.svc.GetList(ctx, filter); !isBadRequest(err) {
+			t.Errorf("list with threshold %g: %v, want bad request", threshold, err)
+		}
+		if _, err := f.svc.Aggregate(ctx, filter, "mime", "count", ""); !isBadRequest(err) {
+			t.Errorf("aggregate with threshold %g: %v, want bad request", threshold, err)
+		}
+	}
+
+	filter := f.filter(f.owner)
+	filter.Mode = "fuzzy"
+	if _, err := f.svc.Aggregate(ctx, filter, "mime", "count", ""); !isBadRequest(err) {
+		t.Errorf("aggregate with unknown mode: %v, want bad request", err)
+	}
+
+	zero := 0.0
+	filter = f.filter(f.owner)
+	filter.Mode = entities.SearchModeSimilar
+	filter.Threshold = &zero
+	if _, err := f.svc.GetList(ctx, filter); err != nil {
+		t.Fatalf("list with threshold 0: %v", err)
+	}
+	if *filter.Threshold != 0 {
+		t.Errorf("threshold 0 replaced by %g", *filter.Threshold)
+	}
+
+	filter = f.filter(f.owner)
+	filter.Mode = entities.SearchModeSimilar
+	if _, err := f.svc.GetList(ctx, filter); err != nil {
+		t.Fatalf("list without threshold: %v", err)
+	}
+	if filter.Threshold == nil || *filter.Threshold != 0.3 {
+		t.Errorf("threshold = %v, want the configured 0.3", filter.Threshold)
+	}
+}
+
+func TestDocumentServiceGetByIDReadsYourLocks(t *testing.T) {
+	f := newDocumentFixture()
+	ctx := context.Background()
+
+	doc := f.create(t, "a.json", `{"n":1}`)
+	if _, err := f.svc.GetByID(ctx, doc.ID, f.owner.Login, nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	if _, err := f.svc.Lock(ctx, doc.ID, f.owner, time.Minute); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	got, err := f.svc.GetByID(ctx, doc.ID, f.owner.Login, nil)
+	if err != nil {
+		t.Fatalf("get after lock: %v", err)
+	}
+	if got.Lock == nil || got.Lock.Holder != f.owner.Login {
+		t.Fatalf("lock right after locking = %+v, want held by %s", got.Lock, f.owner.Login)
+	}
+
+	if _, err := f.svc.Unlock(ctx, doc.ID, f.owner, false); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	got, err = f.svc.GetByID(ctx, doc.ID, f.owner.Login, nil)
+	if err != nil {
+		t.Fatalf("get after unlock: %v", err)
+	}
+	if got.Lock != nil {
+		t.Fatalf("lock right after unlocking = %+v, want none", got.Lock)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/pkg/logger"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	changeEventsChannel = "events:documents"
+
+	// subscriberBuffer is how far a stream may fall behind before it is
+	// dropped; the client resumes with Last-Event-ID.
+	subscriberBuffer = 64
+)
+
+// PubSubClient fans messages out to every replica. Subscribe delivers
+// messages until ctx is done, then closes the channel.
+type PubSubClient interface {
+	Publish(ctx context.Context, channel string, message any) error
+	Subscribe(ctx context.Context, channel string) <-chan string
+}
+
+// changeMessage is a change event as sent between replicas. Access lists
+// everyone who may see the event; it is never sent to clients.
+type changeMessage struct {
+	Event  *entities.ChangeEvent     `json:"event"`
+	Access []entities.DocumentAccess `json:"access"`
+}
+
+// EventSubscription is one client stream. Replay holds the buffered events
+// after the requested Last-Event-ID; Reset is set if that event is no longer
+// buffered and the client has to reload. Events is closed when the
+// subscription ends or falls too far behind.
+type EventSubscription struct {
+	Replay []*entities.ChangeEvent
+	Reset  bool
+	Events <-chan *entities.ChangeEvent
+
+	user   *entities.User
+	events chan *entities.ChangeEvent
+}
+
+type EventService struct {
+	pubsub     PubSubClient
+	bufferSize int
+	logger     *zap.Logger
+
+	mu          sync.Mutex
+	buffer      []*changeMessage
+	subscribers map[*EventSubscription]struct{}
+}
+
+func NewEventService(pubsub PubSubClient, bufferSize int) *EventService {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+
+	return &EventService{
+		pubsub:      pubsub,
+		bufferSize:  bufferSize,
+		logger:      logger.Logger,
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// Publish sends event to the streams of all replicas. It reaches users
+// allowed by any of access, so a change that revokes access is still seen by
+// the users who lose it.
+func (s *EventService) Publish(ctx context.Context, event *entities.ChangeEvent, access ...entities.DocumentAccess) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(&changeMessage{Event: event, Access: access})
+	if err != nil {
+		s.logger.Error("Failed to encode change event",
+			zap.String("event_type", event.Type),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	publishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := s.pubsub.Publish(publishCtx, changeEventsChannel, data); err != nil {
+		s.logger.Error("Failed to publish change event",
+			zap.String("event_id", event.ID),
+			zap.String("event_type", event.Type),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// Run receives the events published by every replica, buffers them for
+// resume and hands them to the local streams until ctx is done.
+func (s *EventService) Run(ctx context.Context) {
+	for payload := range s.pubsub.Subscribe(ctx, changeEventsChannel) {
+		var msg changeMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Event == nil {
+			s.logger.Warn("Ignoring malformed change event",
+				zap.Error(err),
+			)
+			continue
+		}
+		s.dispatch(&msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (s *EventService) dispatch(msg *changeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buffer) == s.bufferSize {
+		copy(s.buffer, s.buffer[1:])
+		s.buffer = s.buffer[:len(s.buffer)-1]
+	}
+	s.buffer = append(s.buffer, msg)
+
+	for sub := range s.subscribers {
+		if !msg.visibleTo(sub.user) {
+			continue
+		}
+
+		select {
+		case sub.events <- msg.Event:
+		default:
+			s.logger.Warn("Change stream fell behind, closing it",
+				zap.String("user_login", sub.user.Login),
+			)
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe opens a stream of the events user may see. With lastEventID set
+// the events after it are replayed first.
+func (s *EventService) Subscribe(user *entities.User, lastEventID string) *EventSubscription {
+	events := make(chan *entities.ChangeEvent, subscriberBuffer)
+	sub := &EventSubscription{
+		Events: events,
+		user:   user,
+		events: events,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lastEventID != "" {
+		start := -1
+		for i, msg := range s.buffer {
+			if msg.Event.ID == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+
+		if start < 0 {
+			sub.Reset = true
+		} else {
+			for _, msg := range s.buffer[start:] {
+				if msg.visibleTo(user) {
+					sub.Replay = append(sub.Replay, msg.Event)
+				}
+			}
+		}
+	}
+
+	s.subscribers[sub] = struct{}{}
+
+	s.logger.Debug("Change stream opened",
+		zap.String("user_login", user.Login),
+		zap.String("last_event_id", lastEventID),
+		zap.Int("replayed", len(sub.Replay)),
+		zap.Bool("reset", sub.Reset),
+	)
+
+	return sub
+}
+
+// Unsubscribe ends a stream opened by Subscribe.
+func (s *EventService) Unsubscribe(sub *EventSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (m *changeMessage) visibleTo(user *entities.User) bool {
+	for _, access := range m.Access {
+		if access.Allows(user) {
+			return true
+		}
+	}
+	return false
+}
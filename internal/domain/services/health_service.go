@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusDegraded    = "degraded"
+	HealthStatusUnavailable = "unavailable"
+
+	// healthCheckTimeout bounds each dependency check, so a hung dependency
+	// fails its check instead of the probe.
+	healthCheckTimeout = 2 * time.Second
+)
+
+// HealthCheck probes one dependency. The server is not ready while a
+// required check fails; a failing optional one only degrades it.
+type HealthCheck struct {
+	Name     string
+	Optional bool
+	Check    func(ctx context.Context) error
+}
+
+type DependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Ready        bool                `json:"ready"`
+	Status       string              `json:"status"`
+	Draining     bool                `json:"draining,omitempty"`
+	Dependencies []*DependencyHealth `json:"dependencies"`
+}
+
+// ServerStatus is the detailed report for administrators.
+type ServerStatus struct {
+	*HealthReport
+	Versions  map[string]string `json:"versions"`
+	StartedAt time.Time         `json:"started_at"`
+	Uptime    string            `json:"uptime"`
+}
+
+type HealthService struct {
+	checks    []HealthCheck
+	versions  func(ctx context.Context) map[string]string
+	startedAt time.Time
+	draining  atomic.Bool
+}
+
+// NewHealthService checks the given dependencies. versions reports the
+// versions shown in the status, such as those of the build and the schema.
+func NewHealthService(versions func(ctx context.Context) map[string]string, checks ...HealthCheck) *HealthService {
+	return &HealthService{
+		checks:    checks,
+		versions:  versions,
+		startedAt: time.Now(),
+	}
+}
+
+// Drain marks the server as shutting down: it stops being ready, so it is
+// taken out of rotation while it finishes the requests it has.
+func (s *HealthService) Drain() {
+	s.draining.Store(true)
+}
+
+// Check runs every dependency check at once.
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Ready:        true,
+		Status:       HealthStatusOK,
+		Draining:     s.draining.Load(),
+		Dependencies: make([]*DependencyHealth, len(s.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Dependencies[i] = runHealthCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, dep := range report.Dependencies {
+		if dep.Status == HealthStatusOK {
+			continue
+		}
+		if !dep.Optional {
+			report.Ready = false
+			report.Status = HealthStatusUnavailable
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	if report.Draining {
+		report.Ready = false
+	}
+
+	return report
+}
+
+func (s *HealthService) Status(ctx context.Context) *ServerStatus {
+	return &ServerStatus{
+		HealthReport: s.Check(ctx),
+		Versions:     s.versions(ctx),
+		StartedAt:    s.startedAt,
+		Uptime:       time.Since(s.startedAt).Round(time.Second).String(),
+	}
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) *DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+
+	dep := &DependencyHealth{
+		Name:      check.Name,
+		Status:    HealthStatusOK,
+		Optional:  check.Optional,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		dep.Status = HealthStatusUnavailable
+		if check.Optional {
+			dep.Status = HealthStatusDegraded
+		}
+		dep.Error = err.Error()
+	}
+	return dep
+}
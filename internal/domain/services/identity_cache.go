@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"document-server/internal/domain/entities"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sessions are cached under a hash of their token, so tokens never appear
+// in Redis.
+func sessionCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("session:%s", hex.EncodeToString(sum[:]))
+}
+
+// revokedSession is cached in place of a revoked session for the session
+// TTL. Sessions are only cached where nothing is, so a lookup that read the
+// session from the database before it was deleted cannot cache it again.
+const revokedSession = "revoked"
+
+func userIDCacheKey(userID string) string {
+	return fmt.Sprintf("user:id:%s", userID)
+}
+
+func userLoginCacheKey(login string) string {
+	return fmt.Sprintf("user:login:%s", login)
+}
+
+func (s *redisCacheService) GetSession(ctx context.Context, token string) (*entities.Session, error) {
+	data, err := s.client.Get(ctx, sessionCacheKey(token))
+	if err != nil {
+		return nil, err
+	}
+	if data == revokedSession {
+		return nil, ErrCacheMiss
+	}
+
+	var session entities.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	session.Token = token
+
+	return &session, nil
+}
+
+// SetSession caches session for the session TTL, or until it expires if
+// that comes first, unless its key holds a session or tombstone already.
+func (s *redisCacheService) SetSession(ctx context.Context, session *entities.Session) error {
+	ttl := s.ttls.Session
+	if left := time.Until(session.ExpiresAt); left < ttl {
+		ttl = left
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	cached := *session
+	cached.Token = ""
+	data, err := json.Marshal(&cached)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.SetNX(ctx, sessionCacheKey(session.Token), data, ttl)
+	return err
+}
+
+func (s *redisCacheService) InvalidateSession(ctx context.Context, token string) error {
+	return s.client.Set(ctx, sessionCacheKey(token), revokedSession, s.ttls.Session)
+}
+
+func (s *redisCacheService) GetUserByID(ctx context.Context, userID string) (*entities.User, error) {
+	return s.getUser(ctx, userIDCacheKey(userID))
+}
+
+func (s *redisCacheService) GetUserByLogin(ctx context.Context, login string) (*entities.User, error) {
+	return s.getUser(ctx, userLoginCacheKey(login))
+}
+
+func (s *redisCacheService) getUser(ctx context.Context, key string) (*entities.User, error) {
+	data, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var user entities.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SetUser caches user under both their ID and login. The password hash is
+// left out by the user's JSON encoding.
+func (s *redisCacheService) SetUser(ctx context.Context, user *entities.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Pipelined(ctx, func(pipe RedisPipeliner) {
+		pipe.Set(userIDCacheKey(user.ID), data, s.ttls.User)
+		pipe.Set(userLoginCacheKey(user.Login), data, s.ttls.User)
+	})
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OutboxHandler applies one outbox message. Messages are delivered at least
+// once, so handlers must be idempotent.
+type OutboxHandler func(ctx context.Context, messageID int64, payload json.RawMessage) error
+
+type OutboxOptions struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+// OutboxService is the relay that applies the side effects queued in the
+// outbox, retrying failed ones with backoff until they succeed.
+type OutboxService struct {
+	outboxRepo repositories.OutboxRepository
+	opts       OutboxOptions
+	handlers   map[string]OutboxHandler
+	wake       chan struct{}
+	logger     *zap.Logger
+}
+
+func NewOutboxService(outboxRepo repositories.OutboxRepository, opts OutboxOptions) *OutboxService {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = time.Second
+	}
+	if opts.BackoffMax < opts.BackoffBase {
+		opts.BackoffMax = opts.BackoffBase
+	}
+
+	return &OutboxService{
+		outboxRepo: outboxRepo,
+		opts:       opts,
+		handlers:   make(map[string]OutboxHandler),
+		wake:       make(chan struct{}, 1),
+		logger:     logger.Logger,
+	}
+}
+
+// Handle registers the handler for messages of kind. Handlers must be
+// registered before the relay runs.
+func (s *OutboxService) Handle(kind string, handler OutboxHandler) {
+	s.handlers[kind] = handler
+}
+
+// Notify wakes the relay after a write committed messages, so their effects
+// do not wait for the next poll.
+func (s *OutboxService) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run applies due messages until ctx is done.
+func (s *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for s.relay(ctx) == s.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Drain applies the messages that are due now, for use on shutdown once Run
+// has returned. It stops early when ctx is done.
+func (s *OutboxService) Drain(ctx context.Context) {
+	s.logger.Info("Draining outbox")
+
+	total := 0
+	for ctx.Err() == nil {
+		n := s.relay(ctx)
+		total += n
+		if n < s.opts.BatchSize {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		s.logger.Warn("Outbox drain stopped before it finished, the rest is applied on the next start",
+			zap.Int("messages", total),
+			zap.Error(ctx.Err()),
+		)
+		return
+	}
+
+	s.logger.Info("Outbox drained",
+		zap.Int("messages", total),
+	)
+}
+
+// relay applies one batch of due messages and returns its size.
+func (s *OutboxService) relay(ctx context.Context) int {
+	messages, err := s.outboxRepo.Claim(ctx, s.opts.BatchSize, s.opts.Lease)
+	if err != nil {
+		s.logger.Error("Failed to claim outbox messages",
+			zap.Error(err),
+		)
+		return 0
+	}
+
+	for _, message := range messages {
+		s.apply(ctx, message)
+	}
+
+	return len(messages)
+}
+
+func (s *OutboxService) apply(ctx context.Context, message *entities.OutboxMessage) {
+	handler, ok := s.handlers[message.Kind]
+	if !ok {
+		s.fail(ctx, message, fmt.Errorf("no handler for %q", message.Kind))
+		return
+	}
+
+	if err := handler(ctx, message.ID, message.Payload); err != nil {
+		s.fail(ctx, message, err)
+		return
+	}
+
+	if err := s.outboxRepo.Complete(ctx, message.ID); err != nil {
+		s.logger.Error("Failed to complete outbox message",
+			zap.Int64("message_id", message.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	s.logger.Debug("Outbox message applied",
+		zap.Int64("message_id", message.ID),
+		zap.String("kind", message.Kind),
+		zap.Int("attempt", message.Attempts),
+	)
+}
+
+func (s *OutboxService) fail(ctx context.Context, message *entities.OutboxMessage, cause error) {
+	delay := s.opts.BackoffBase
+	for i := 1; i < message.Attempts && delay < s.opts.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.BackoffMax {
+		delay = s.opts.BackoffMax
+	}
+
+	if err := s.outboxRepo.Fail(ctx, message.ID, delay, cause.Error()); err != nil {
+		s.logger.Error("Failed to record outbox failure",
+			zap.Int64("message_id", message.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	s.logger.Warn("Outbox message failed, will retry",
+		zap.Int64("message_id", message.ID),
+		zap.String("kind", message.Kind),
+		zap.Int("attempt", message.Attempts),
+		zap.Duration("retry_in", delay),
+		zap.Error(cause),
+	)
+}
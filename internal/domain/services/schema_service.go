@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"go.uber.org/zap"
+)
+
+type compiledSchema struct {
+	updatedAt time.Time
+	schema    *jsonschema.Schema
+}
+
+type SchemaService struct {
+	schemaRepo repositories.SchemaRepository
+	logger     *zap.Logger
+
+	mu       sync.RWMutex
+	compiled map[string]compiledSchema
+}
+
+func NewSchemaService(schemaRepo repositories.SchemaRepository) *SchemaService {
+	return &SchemaService{
+		schemaRepo: schemaRepo,
+		logger:     logger.Logger,
+		compiled:   make(map[string]compiledSchema),
+	}
+}
+
+func (s *SchemaService) Upsert(ctx context.Context, user *entities.User, name string, schema json.RawMessage, patterns []string) (*entities.JSONSchema, error) {
+	s.logger.Debug("Upserting JSON schema",
+		zap.String("user_id", user.ID),
+		zap.String("name", name),
+		zap.Strings("patterns", patterns),
+	)
+
+	if name == "" {
+		return nil, errors.NewBadRequestError("schema name is required")
+	}
+
+	if _, err := compileSchema(name, schema); err != nil {
+		s.logger.Warn("Rejected invalid JSON schema",
+			zap.String("user_id", user.ID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return nil, errors.NewBadRequestError("invalid schema: " + err.Error())
+	}
+
+	if patterns == nil {
+		patterns = []string{}
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("invalid name pattern %q", pattern))
+		}
+	}
+
+	entity := &entities.JSONSchema{
+		Name:     name,
+		OwnerID:  user.ID,
+		Schema:   schema,
+		Patterns: patterns,
+	}
+
+	if err := s.schemaRepo.Upsert(ctx, entity); err != nil {
+		s.logger.Error("Failed to upsert JSON schema",
+			zap.String("user_id", user.ID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to save schema")
+	}
+
+	s.logger.Info("JSON schema saved successfully",
+		zap.String("schema_id", entity.ID),
+		zap.String("user_id", user.ID),
+		zap.String("name", name),
+	)
+
+	return entity, nil
+}
+
+func (s *SchemaService) GetByName(ctx context.Context, user *entities.User, name string) (*entities.JSONSchema, error) {
+	schema, err := s.schemaRepo.GetByName(ctx, user.ID, name)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return nil, err
+		}
+		s.logger.Error("Failed to get JSON schema",
+			zap.String("user_id", user.ID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to get schema")
+	}
+	return schema, nil
+}
+
+func (s *SchemaService) List(ctx context.Context, user *entities.User) ([]*entities.JSONSchema, error) {
+	schemas, err := s.schemaRepo.ListByOwner(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("Failed to list JSON schemas",
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to list schemas")
+	}
+	return schemas, nil
+}
+
+func (s *SchemaService) Delete(ctx context.Context, user *entities.User, name string) error {
+	if err := s.schemaRepo.Delete(ctx, user.ID, name); err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return err
+		}
+		s.logger.Error("Failed to delete JSON schema",
+			zap.String("user_id", user.ID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return errors.NewInternalError("failed to delete schema")
+	}
+
+	s.logger.Info("JSON schema deleted successfully",
+		zap.String("user_id", user.ID),
+		zap.String("name", name),
+	)
+	return nil
+}
+
+// Validate checks the JSON body of doc against the schema attached to it and
+// against every schema of the owner whose name patterns match the document
+// name. Documents without a JSON body are always valid.
+func (s *SchemaService) Validate(ctx context.Context, doc *entities.Document) error {
+	if doc.JSONData == nil || len(bytes.TrimSpace(*doc.JSONData)) == 0 {
+		return nil
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(*doc.JSONData))
+	if err != nil {
+		return errors.NewBadRequestError("json must be a valid JSON document")
+	}
+
+	schemas, err := s.applicableSchemas(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	var details []errors.ValidationDetail
+	for _, schema := range schemas {
+		compiled, err := s.compiledFor(schema)
+		if err != nil {
+			s.logger.Error("Stored JSON schema failed to compile",
+				zap.String("schema_id", schema.ID),
+				zap.Error(err),
+			)
+			return errors.NewInternalError("failed to compile schema")
+		}
+
+		if err := compiled.Validate(instance); err != nil {
+			validationErr, ok := err.(*jsonschema.ValidationError)
+			if !ok {
+				return errors.NewInternalError("failed to validate document")
+			}
+			details = append(details, validationDetails(schema.Name, validationErr)...)
+		}
+	}
+
+	if len(details) > 0 {
+		s.logger.Debug("Document failed schema validation",
+			zap.String("doc_id", doc.ID),
+			zap.String("name", doc.Name),
+			zap.Int("errors", len(details)),
+		)
+		return errors.NewValidationError("document does not match schema", details)
+	}
+
+	return nil
+}
+
+// ResolveID returns the ID of the named schema owned by ownerID.
+func (s *SchemaService) ResolveID(ctx context.Context, ownerID, name string) (string, error) {
+	schema, err := s.schemaRepo.GetByName(ctx, ownerID, name)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return "", errors.NewBadRequestError(fmt.Sprintf("schema %q not found", name))
+		}
+		return "", errors.NewInternalError("failed to get schema")
+	}
+	return schema.ID, nil
+}
+
+func (s *SchemaService) applicableSchemas(ctx context.Context, doc *entities.Document) ([]*entities.JSONSchema, error) {
+	var schemas []*entities.JSONSchema
+
+	if doc.SchemaID != nil {
+		schema, err := s.schemaRepo.GetByID(ctx, *doc.SchemaID)
+		if err != nil {
+			if _, ok := err.(*errors.NotFoundError); !ok {
+				s.logger.Error("Failed to get attached schema",
+					zap.String("schema_id", *doc.SchemaID),
+					zap.Error(err),
+				)
+				return nil, errors.NewInternalError("failed to get schema")
+			}
+		} else {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	owned, err := s.schemaRepo.ListByOwner(ctx, doc.OwnerID)
+	if err != nil {
+		s.logger.Error("Failed to list schemas for pattern matching",
+			zap.String("owner_id", doc.OwnerID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to get schemas")
+	}
+
+	for _, schema := range owned {
+		if doc.SchemaID != nil && schema.ID == *doc.SchemaID {
+			continue
+		}
+		for _, pattern := range schema.Patterns {
+			if matched, _ := path.Match(pattern, doc.Name); matched {
+				schemas = append(schemas, schema)
+				break
+			}
+		}
+	}
+
+	return schemas, nil
+}
+
+func (s *SchemaService) compiledFor(schema *entities.JSONSchema) (*jsonschema.Schema, error) {
+	s.mu.RLock()
+	cached, ok := s.compiled[schema.ID]
+	s.mu.RUnlock()
+	if ok && cached.updatedAt.Equal(schema.UpdatedAt) {
+		return cached.schema, nil
+	}
+
+	compiled, err := compileSchema(schema.ID, schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.compiled[schema.ID] = compiledSchema{updatedAt: schema.UpdatedAt, schema: compiled}
+	s.mu.Unlock()
+
+	return compiled, nil
+}
+
+// compileSchema compiles a draft 2020-12 schema. No URL loader is configured,
+// so references to anything but the schema itself and the standard
+// meta-schemas fail to compile.
+func compileSchema(id string, raw json.RawMessage) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	url := "urn:document-server:schema:" + id
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	if err := compiler.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(url)
+}
+
+func validationDetails(schemaName string, err *jsonschema.ValidationError) []errors.ValidationDetail {
+	var details []errors.ValidationDetail
+	for _, unit := range err.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		instancePath := unit.InstanceLocation
+		if instancePath == "" {
+			instancePath = "/"
+		}
+		details = append(details, errors.ValidationDetail{
+			Path:    instancePath,
+			Message: fmt.Sprintf("%s (schema %q at %s)", unit.Error.String(), schemaName, unit.KeywordLocation),
+		})
+	}
+	return details
+}
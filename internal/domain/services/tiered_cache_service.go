@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/pkg/logger"
+	"document-server/pkg/lru"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const cacheInvalidationChannel = "cache:invalidate"
+
+type TieredCacheOptions struct {
+	// Size is the number of documents and lists kept in process.
+	Size int
+	// TTL bounds how long a replica may serve a local copy whose eviction
+	// message it missed.
+	TTL           time.Duration
+	StatsInterval time.Duration
+}
+
+type CacheTierStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type CacheStats struct {
+	Local  CacheTierStats `json:"local"`
+	Remote CacheTierStats `json:"remote"`
+}
+
+// cacheInvalidation tells the other replicas which local entries to evict.
+type cacheInvalidation struct {
+	Origin  string `json:"origin"`
+	DocID   string `json:"doc_id,omitempty"`
+	OwnerID string `json:"owner_id,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+}
+
+// localEntry is a document or list as cached in process. It is kept encoded
+// so callers never share the cached value. Lists remember their documents
+// for eviction.
+type localEntry struct {
+	data   []byte
+	docIDs []string
+}
+
+// TieredCacheService keeps the hottest documents and lists in process in
+// front of the shared cache. Invalidations are applied to both tiers and
+// broadcast so every replica evicts its local copies. The local tier is
+// evicted first, so a replica never serves its own stale writes even when
+// the shared cache is down.
+type TieredCacheService struct {
+	remote CacheService
+	pubsub PubSubClient
+	local  *lru.Cache[string, *localEntry]
+	origin string
+	opts   TieredCacheOptions
+	logger *zap.Logger
+
+	localHits    atomic.Uint64
+	localMisses  atomic.Uint64
+	remoteHits   atomic.Uint64
+	remoteMisses atomic.Uint64
+}
+
+func NewTieredCacheService(remote CacheService, pubsub PubSubClient, opts TieredCacheOptions) *TieredCacheService {
+	if opts.Size <= 0 {
+		opts.Size = 10000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 5 * time.Second
+	}
+
+	return &TieredCacheService{
+		remote: remote,
+		pubsub: pubsub,
+		local:  lru.New[string, *localEntry](opts.Size, opts.TTL),
+		origin: uuid.NewString(),
+		opts:   opts,
+		logger: logger.Logger,
+	}
+}
+
+func (s *TieredCacheService) GetDocument(ctx context.Context, docID string) (*entities.Document, bool, error) {
+	if entry, ok := s.local.Get(documentCacheKey(docID)); ok {
+		var doc entities.Document
+		if err := json.Unmarshal(entry.data, &doc); err == nil {
+			s.localHits.Add(1)
+			return &doc, true, nil
+		}
+	}
+	s.localMisses.Add(1)
+
+	doc, fresh, err := s.remote.GetDocument(ctx, docID)
+	if err != nil {
+		s.countRemoteError(err)
+		return nil, false, err
+	}
+	s.remoteHits.Add(1)
+
+	// Stale documents are left to the shared tier, so the refreshed one is
+	// picked up as soon as it lands there.
+	if fresh {
+		s.storeLocal(documentCacheKey(docID), doc, &localEntry{})
+	}
+	return doc, fresh, nil
+}
+
+// SetDocument caches doc in both tiers without telling the other replicas:
+// fills after a miss store what the database already holds, and writes
+// reach their local copies through InvalidateDocument.
+func (s *TieredCacheService) SetDocument(ctx context.Context, doc *entities.Document) error {
+	if err := s.remote.SetDocument(ctx, doc); err != nil {
+		return err
+	}
+
+	s.storeLocal(documentCacheKey(doc.ID), doc, &localEntry{})
+	return nil
+}
+
+func (s *TieredCacheService) LockDocumentLoad(ctx context.Context, docID string) (bool, error) {
+	return s.remote.LockDocumentLoad(ctx, docID)
+}
+
+func (s *TieredCacheService) UnlockDocumentLoad(ctx context.Context, docID string) error {
+	return s.remote.UnlockDocumentLoad(ctx, docID)
+}
+
+func (s *TieredCacheService) GetDocumentList(ctx context.Context, key string) ([]*entities.Document, error) {
+	if entry, ok := s.local.Get(key); ok {
+		var docs []*entities.Document
+		if err := json.Unmarshal(entry.data, &docs); err == nil {
+			s.localHits.Add(1)
+			return docs, nil
+		}
+	}
+	s.localMisses.Add(1)
+
+	docs, err := s.remote.GetDocumentList(ctx, key)
+	if err != nil {
+		s.countRemoteError(err)
+		return nil, err
+	}
+	s.remoteHits.Add(1)
+
+	s.storeLocalList(key, docs)
+	return docs, nil
+}
+
+func (s *TieredCacheService) SetDocumentList(ctx context.Context, ownerID, key string, docs []*entities.Document) error {
+	if err := s.remote.SetDocumentList(ctx, ownerID, key, docs); err != nil {
+		return err
+	}
+
+	s.storeLocalList(key, docs)
+	return nil
+}
+
+func (s *TieredCacheService) InvalidateDocument(ctx context.Context, docID string) error {
+	msg := &cacheInvalidation{DocID: docID}
+	s.evict(msg)
+	if err := s.remote.InvalidateDocument(ctx, docID); err != nil {
+		return err
+	}
+	return s.broadcast(ctx, msg)
+}
+
+func (s *TieredCacheService) InvalidatePrefix(ctx context.Context, prefix string) error {
+	msg := &cacheInvalidation{Prefix: prefix}
+	s.evict(msg)
+	if err := s.remote.InvalidatePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	return s.broadcast(ctx, msg)
+}
+
+func (s *TieredCacheService) ListCacheKey(ctx context.Context, filter *entities.DocumentFilter) (string, error) {
+	return s.remote.ListCacheKey(ctx, filter)
+}
+
+func (s *TieredCacheService) InvalidateOwnerLists(ctx context.Context, ownerID string) error {
+	msg := &cacheInvalidation{OwnerID: ownerID}
+	s.evict(msg)
+	if err := s.remote.InvalidateOwnerLists(ctx, ownerID); err != nil {
+		return err
+	}
+	return s.broadcast(ctx, msg)
+}
+
+// Sessions and users are only cached in the shared tier, so revoking them
+// takes effect on every replica at once.
+
+func (s *TieredCacheService) GetSession(ctx context.Context, token string) (*entities.Session, error) {
+	return s.remote.GetSession(ctx, token)
+}
+
+func (s *TieredCacheService) SetSession(ctx context.Context, session *entities.Session) error {
+	return s.remote.SetSession(ctx, session)
+}
+
+func (s *TieredCacheService) InvalidateSession(ctx context.Context, token string) error {
+	return s.remote.InvalidateSession(ctx, token)
+}
+
+func (s *TieredCacheService) GetUserByID(ctx context.Context, userID string) (*entities.User, error) {
+	return s.remote.GetUserByID(ctx, userID)
+}
+
+func (s *TieredCacheService) GetUserByLogin(ctx context.Context, login string) (*entities.User, error) {
+	return s.remote.GetUserByLogin(ctx, login)
+}
+
+func (s *TieredCacheService) SetUser(ctx context.Context, user *entities.User) error {
+	return s.remote.SetUser(ctx, user)
+}
+
+// Stats returns the hit and miss counters of both tiers since start.
+func (s *TieredCacheService) Stats() CacheStats {
+	return CacheStats{
+		Local: CacheTierStats{
+			Hits:   s.localHits.Load(),
+			Misses: s.localMisses.Load(),
+		},
+		Remote: CacheTierStats{
+			Hits:   s.remoteHits.Load(),
+			Misses: s.remoteMisses.Load(),
+		},
+	}
+}
+
+// Run applies the invalidations broadcast by the other replicas and logs the
+// cache statistics until ctx is done.
+func (s *TieredCacheService) Run(ctx context.Context) {
+	var statsTick <-chan time.Time
+	if s.opts.StatsInterval > 0 {
+		ticker := time.NewTicker(s.opts.StatsInterval)
+		defer ticker.Stop()
+		statsTick = ticker.C
+	}
+
+	messages := s.pubsub.Subscribe(ctx, cacheInvalidationChannel)
+	for {
+		select {
+		case payload, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var msg cacheInvalidation
+			if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+				s.logger.Warn("Ignoring malformed cache invalidation",
+					zap.Error(err),
+				)
+				continue
+			}
+			if msg.Origin != s.origin {
+				s.evict(&msg)
+			}
+		case <-statsTick:
+			stats := s.Stats()
+			s.logger.Info("Cache statistics",
+				zap.Uint64("local_hits", stats.Local.Hits),
+				zap.Uint64("local_misses", stats.Local.Misses),
+				zap.Uint64("remote_hits", stats.Remote.Hits),
+				zap.Uint64("remote_misses", stats.Remote.Misses),
+				zap.Int("local_entries", s.local.Len()),
+			)
+		}
+	}
+}
+
+func (s *TieredCacheService) storeLocal(key string, value any, entry *localEntry) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.logger.Warn("Failed to encode local cache entry",
+			zap.String("cache_key", key),
+			zap.Error(err),
+		)
+		return
+	}
+
+	entry.data = data
+	s.local.Add(key, entry)
+}
+
+func (s *TieredCacheService) storeLocalList(key string, docs []*entities.Document) {
+	docIDs := make([]string, len(docs))
+	for i, doc := range docs {
+		docIDs[i] = doc.ID
+	}
+	s.storeLocal(key, docs, &localEntry{docIDs: docIDs})
+}
+
+// evict drops the local entries msg refers to: a document along with the
+// lists containing it, the lists of an owner or the keys under a prefix.
+func (s *TieredCacheService) evict(msg *cacheInvalidation) {
+	if msg.DocID != "" {
+		s.local.Remove(documentCacheKey(msg.DocID))
+	}
+
+	evicted := s.local.RemoveFunc(func(key string, entry *localEntry) bool {
+		switch {
+		case msg.Prefix != "" && strings.HasPrefix(key, msg.Prefix):
+			return true
+		case msg.OwnerID != "" && strings.HasPrefix(key, ownerListsPrefix(msg.OwnerID)):
+			return true
+		case msg.DocID != "":
+			for _, docID := range entry.docIDs {
+				if docID == msg.DocID {
+					return true
+				}
+			}
+		}
+		return false
+	})
+
+	s.logger.Debug("Local cache entries evicted",
+		zap.String("doc_id", msg.DocID),
+		zap.String("owner_id", msg.OwnerID),
+		zap.String("prefix", msg.Prefix),
+		zap.Int("lists", evicted),
+	)
+}
+
+func (s *TieredCacheService) broadcast(ctx context.Context, msg *cacheInvalidation) error {
+	msg.Origin = s.origin
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pubsub.Publish(ctx, cacheInvalidationChannel, data); err != nil {
+		return fmt.Errorf("broadcast cache invalidation: %w", err)
+	}
+	return nil
+}
+
+func (s *TieredCacheService) countRemoteError(err error) {
+	if errors.Is(err, ErrCacheMiss) {
+		s.remoteMisses.Add(1)
+	}
+}
+
+var _ CacheService = (*TieredCacheService)(nil)
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"document-server/pkg/errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("document-server/internal/domain/services")
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span with the outcome of its call. Errors the client caused
+// are recorded but do not fail the span; they are answered with a 4xx.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if isServerError(err) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func isServerError(err error) bool {
+	switch err.(type) {
+	case *errors.BadRequestError,
+		*errors.UnauthorizedError,
+		*errors.ForbiddenError,
+		*errors.NotFoundError,
+		*errors.ConflictError,
+		*errors.PreconditionFailedError,
+		*errors.LockedError,
+		*errors.PreconditionRequiredError,
+		*errors.UnprocessableEntityError,
+		*errors.ValidationError:
+		return false
+	default:
+		return true
+	}
+}
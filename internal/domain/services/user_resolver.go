@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/pkg/logger"
+	stdErrors "errors"
+
+	"go.uber.org/zap"
+)
+
+// UserResolver looks sessions and users up through the cache, since nearly
+// every request resolves its token and the users it checks access for.
+// Anything that ends a session goes through it too, so the cached copy is
+// dropped as soon as the database is changed. Users never change once
+// registered; should that be added, their cached copies have to be dropped
+// the same way.
+//
+// Users it returns carry no password hash; authenticate against the
+// repository.
+type UserResolver struct {
+	userRepo    repositories.UserRepository
+	sessionRepo repositories.SessionRepository
+	cache       CacheService
+	logger      *zap.Logger
+}
+
+func NewUserResolver(userRepo repositories.UserRepository, sessionRepo repositories.SessionRepository, cache CacheService) *UserResolver {
+	return &UserResolver{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		cache:       cache,
+		logger:      logger.Logger,
+	}
+}
+
+func (r *UserResolver) Session(ctx context.Context, token string) (*entities.Session, error) {
+	session, err := r.cache.GetSession(ctx, token)
+	if err == nil {
+		return session, nil
+	}
+	r.cacheFailed("Failed to read cached session", err)
+
+	session, err = r.sessionRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.cache.SetSession(ctx, session); err != nil {
+		r.cacheFailed("Failed to cache session", err, zap.String("user_id", session.UserID))
+	}
+	return session, nil
+}
+
+func (r *UserResolver) UserByID(ctx context.Context, userID string) (*entities.User, error) {
+	user, err := r.cache.GetUserByID(ctx, userID)
+	if err == nil {
+		return user, nil
+	}
+	r.cacheFailed("Failed to read cached user", err, zap.String("user_id", userID))
+
+	user, err = r.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.store(ctx, user), nil
+}
+
+func (r *UserResolver) UserByLogin(ctx context.Context, login string) (*entities.User, error) {
+	user, err := r.cache.GetUserByLogin(ctx, login)
+	if err == nil {
+		return user, nil
+	}
+	r.cacheFailed("Failed to read cached user", err, zap.String("login", login))
+
+	user, err = r.userRepo.GetByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	return r.store(ctx, user), nil
+}
+
+// RevokeSession deletes the session of token, on logout or when it has
+// expired or been revoked. The cache keeps a tombstone of it afterwards, so a
+// concurrent lookup that read the session before the delete cannot cache it
+// again.
+func (r *UserResolver) RevokeSession(ctx context.Context, token string) error {
+	if err := r.sessionRepo.Delete(ctx, token); err != nil {
+		return err
+	}
+
+	if err := r.cache.InvalidateSession(ctx, token); err != nil && !stdErrors.Is(err, ErrCacheUnavailable) {
+		return err
+	}
+	return nil
+}
+
+func (r *UserResolver) store(ctx context.Context, user *entities.User) *entities.User {
+	cached := *user
+	cached.Password = ""
+
+	if err := r.cache.SetUser(ctx, &cached); err != nil {
+		r.cacheFailed("Failed to cache user", err, zap.String("user_id", user.ID))
+	}
+	return &cached
+}
+
+// cacheFailed logs cache errors other than misses. While the cache is down
+// every lookup would fail, so that is not logged either.
+func (r *UserResolver) cacheFailed(msg string, err error, fields ...zap.Field) {
+	if stdErrors.Is(err, ErrCacheMiss) || stdErrors.Is(err, ErrCacheUnavailable) {
+		return
+	}
+	r.logger.Warn(msg, append(fields, zap.Error(err))...)
+}
@@ -0,0 +1,548 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/internal/utils"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"encoding/hex"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+
+	maxWebhookResponseBody = 1 << 10
+
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+// errBlockedAddress rejects webhook URLs that point into the server's own
+// network: loopback, private, link-local (cloud metadata) and unspecified
+// addresses.
+var errBlockedAddress = stdErrors.New("destination address is not allowed")
+
+type WebhookOptions struct {
+	MaxAttempts  int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	Timeout      time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+type WebhookService struct {
+	webhookRepo repositories.WebhookRepository
+	client      *http.Client
+	opts        WebhookOptions
+	logger      *zap.Logger
+}
+
+func NewWebhookService(webhookRepo repositories.WebhookRepository, opts WebhookOptions) *WebhookService {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 20
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = time.Second
+	}
+	if opts.BackoffMax < opts.BackoffBase {
+		opts.BackoffMax = opts.BackoffBase
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		client:      newWebhookClient(opts.Timeout),
+		opts:        opts,
+		logger:      logger.Logger,
+	}
+}
+
+// newWebhookClient returns a client that only connects to public addresses.
+// The address is checked when dialling, after DNS resolution, so a host name
+// cannot be pointed at an internal address later. Redirects are not
+// followed: they could lead anywhere.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Through a proxy the dialled address would be the proxy's.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// Register creates a webhook. A nil owner registers an administrator's
+// webhook that receives events for all documents. When secret is empty one
+// is generated; it is only returned here.
+func (s *WebhookService) Register(ctx context.Context, owner *entities.User, rawURL string, events []string, secret string) (*entities.Webhook, string, error) {
+	s.logger.Debug("Registering webhook",
+		zap.Bool("admin", owner == nil),
+		zap.String("url", rawURL),
+		zap.Strings("events", events),
+	)
+
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, "", errors.NewBadRequestError("url must be an absolute http or https URL")
+	}
+	// Host names are checked again on every delivery, once resolved.
+	if ip := net.ParseIP(target.Hostname()); (ip != nil && blockedIP(ip)) || target.Hostname() == "localhost" {
+		return nil, "", errors.NewBadRequestError("url must point to a public address")
+	}
+
+	if events == nil {
+		events = []string{}
+	}
+	for _, event := range events {
+		if !slices.Contains(entities.WebhookEventTypes, event) {
+			return nil, "", errors.NewBadRequestError(fmt.Sprintf("unknown event %q", event))
+		}
+	}
+
+	if secret == "" {
+		secret = utils.GenerateToken()
+	}
+
+	webhook := &entities.Webhook{
+		URL:    target.String(),
+		Secret: secret,
+		Events: events,
+		Active: true,
+	}
+	if owner != nil {
+		webhook.OwnerID = &owner.ID
+	}
+
+	if err := s.webhookRepo.Create(ctx, webhook); err != nil {
+		s.logger.Error("Failed to create webhook",
+			zap.String("url", rawURL),
+			zap.Error(err),
+		)
+		return nil, "", errors.NewInternalError("failed to create webhook")
+	}
+
+	s.logger.Info("Webhook registered successfully",
+		zap.String("webhook_id", webhook.ID),
+		zap.Bool("admin", owner == nil),
+		zap.String("url", webhook.URL),
+	)
+
+	return webhook, secret, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, owner *entities.User) ([]*entities.Webhook, error) {
+	webhooks, err := s.webhookRepo.List(ctx, ownerID(owner))
+	if err != nil {
+		s.logger.Error("Failed to list webhooks",
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to list webhooks")
+	}
+
+	if webhooks == nil {
+		webhooks = []*entities.Webhook{}
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, owner *entities.User, webhookID string) error {
+	if _, err := s.getOwned(ctx, owner, webhookID); err != nil {
+		return err
+	}
+
+	if err := s.webhookRepo.Delete(ctx, webhookID); err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return err
+		}
+		s.logger.Error("Failed to delete webhook",
+			zap.String("webhook_id", webhookID),
+			zap.Error(err),
+		)
+		return errors.NewInternalError("failed to delete webhook")
+	}
+
+	s.logger.Info("Webhook deleted successfully",
+		zap.String("webhook_id", webhookID),
+	)
+	return nil
+}
+
+// Deliveries returns the delivery log of a webhook, newest first, optionally
+// restricted to one status.
+func (s *WebhookService) Deliveries(ctx context.Context, owner *entities.User, webhookID, status string, limit, offset int) ([]*entities.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, owner, webhookID); err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case "", entities.DeliveryStatusPending, entities.DeliveryStatusDelivered, entities.DeliveryStatusDead:
+	default:
+		return nil, errors.NewBadRequestError("unknown delivery status")
+	}
+
+	if limit <= 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit > maxDeliveryLimit {
+		limit = maxDeliveryLimit
+	}
+	if offset < 0 {
+		return nil, errors.NewBadRequestError("offset must not be negative")
+	}
+
+	deliveries, err := s.webhookRepo.ListDeliveries(ctx, webhookID, status, limit, offset)
+	if err != nil {
+		s.logger.Error("Failed to list webhook deliveries",
+			zap.String("webhook_id", webhookID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to list webhook deliveries")
+	}
+
+	if deliveries == nil {
+		deliveries = []*entities.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// Replay queues a logged delivery again, whatever its status, with a fresh
+// retry budget.
+func (s *WebhookService) Replay(ctx context.Context, owner *entities.User, webhookID, deliveryID string) (*entities.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, owner, webhookID); err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.webhookRepo.ReplayDelivery(ctx, webhookID, deliveryID)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return nil, err
+		}
+		s.logger.Error("Failed to replay webhook delivery",
+			zap.String("webhook_id", webhookID),
+			zap.String("delivery_id", deliveryID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to replay webhook delivery")
+	}
+
+	s.logger.Info("Webhook delivery queued for replay",
+		zap.String("webhook_id", webhookID),
+		zap.String("delivery_id", deliveryID),
+	)
+
+	return delivery, nil
+}
+
+// Publish queues event for every webhook subscribed to it. It must only be
+// called once the change it describes is committed. Publishing an event ID
+// again does not queue it twice.
+func (s *WebhookService) Publish(ctx context.Context, event *entities.WebhookEvent) error {
+	// The change is already committed, so the event is queued even if the
+	// request was cancelled meanwhile.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	webhooks, err := s.webhookRepo.Subscribers(ctx, event.Type, event.Document.OwnerID)
+	if err != nil {
+		s.logger.Error("Failed to find webhook subscribers",
+			zap.String("event_type", event.Type),
+			zap.String("doc_id", event.Document.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("Failed to encode webhook event",
+			zap.String("event_type", event.Type),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	deliveries := make([]*entities.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = &entities.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   payload,
+		}
+	}
+
+	if err := s.webhookRepo.EnqueueDeliveries(ctx, deliveries); err != nil {
+		s.logger.Error("Failed to enqueue webhook deliveries",
+			zap.String("event_type", event.Type),
+			zap.String("doc_id", event.Document.ID),
+			zap.Int("webhooks", len(webhooks)),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	s.logger.Debug("Webhook event queued",
+		zap.String("event_id", event.ID),
+		zap.String("event_type", event.Type),
+		zap.Int("webhooks", len(webhooks)),
+	)
+
+	return nil
+}
+
+// RunDispatcher sends due deliveries until ctx is done.
+func (s *WebhookService) RunDispatcher(ctx context.Context) {
+	interval := s.opts.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining while full batches come back.
+		for s.dispatch(ctx) == s.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends one batch of due deliveries and returns its size.
+func (s *WebhookService) dispatch(ctx context.Context) int {
+	// A claimed delivery is not picked up again until the whole batch could
+	// have timed out: deliveries are sent one after another.
+	lease := time.Duration(s.opts.BatchSize)*s.opts.Timeout + time.Minute
+
+	deliveries, err := s.webhookRepo.ClaimDueDeliveries(ctx, s.opts.BatchSize, lease)
+	if err != nil {
+		s.logger.Error("Failed to claim webhook deliveries",
+			zap.Error(err),
+		)
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		s.deliver(ctx, delivery)
+	}
+
+	return len(deliveries)
+}
+
+func (s *WebhookService) deliver(ctx context.Context, delivery *entities.WebhookDelivery) {
+	if !delivery.Webhook.Active {
+		s.fail(ctx, delivery, nil, "webhook is inactive", true)
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		s.fail(ctx, delivery, nil, err.Error(), true)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(delivery.Webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Debug("Webhook request failed",
+			zap.String("delivery_id", delivery.ID),
+			zap.Error(err),
+		)
+		s.fail(ctx, delivery, nil, deliveryError(err), stdErrors.Is(err, errBlockedAddress))
+		return
+	}
+	defer resp.Body.Close()
+
+	// The owner can read the delivery log, so the response body is never
+	// kept: it is only drained to reuse the connection.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		s.fail(ctx, delivery, &resp.StatusCode, fmt.Sprintf("endpoint responded %d", resp.StatusCode), false)
+		return
+	}
+
+	if err := s.webhookRepo.MarkDelivered(ctx, delivery.ID, resp.StatusCode); err != nil {
+		s.logger.Error("Failed to mark webhook delivery as delivered",
+			zap.String("delivery_id", delivery.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	s.logger.Debug("Webhook delivered",
+		zap.String("delivery_id", delivery.ID),
+		zap.String("webhook_id", delivery.WebhookID),
+		zap.Int("attempt", delivery.Attempts),
+	)
+}
+
+// fail records a failed attempt. The delivery is retried with exponential
+// backoff until it runs out of attempts, or straight away goes dead when
+// permanent is set.
+func (s *WebhookService) fail(ctx context.Context, delivery *entities.WebhookDelivery, statusCode *int, reason string, permanent bool) {
+	status := entities.DeliveryStatusPending
+	retryIn := s.backoff(delivery.Attempts)
+	if permanent || delivery.Attempts >= s.opts.MaxAttempts {
+		status = entities.DeliveryStatusDead
+	}
+
+	if err := s.webhookRepo.MarkFailed(ctx, delivery.ID, status, retryIn, statusCode, reason); err != nil {
+		s.logger.Error("Failed to record webhook delivery failure",
+			zap.String("delivery_id", delivery.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	s.logger.Warn("Webhook delivery failed",
+		zap.String("delivery_id", delivery.ID),
+		zap.String("webhook_id", delivery.WebhookID),
+		zap.Int("attempt", delivery.Attempts),
+		zap.String("status", status),
+		zap.String("reason", reason),
+	)
+}
+
+// deliveryError describes a failed request for the delivery log without
+// details of the network the server runs in.
+func deliveryError(err error) string {
+	var netErr net.Error
+	switch {
+	case stdErrors.Is(err, errBlockedAddress):
+		return errBlockedAddress.Error()
+	case stdErrors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out"
+	default:
+		return "request failed"
+	}
+}
+
+// backoff returns the delay before the attempt after the given one: the base
+// delay doubled per attempt, capped, with up to 20% jitter.
+func (s *WebhookService) backoff(attempt int) time.Duration {
+	delay := s.opts.BackoffBase
+	for i := 1; i < attempt && delay < s.opts.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.BackoffMax {
+		delay = s.opts.BackoffMax
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+func (s *WebhookService) getOwned(ctx context.Context, owner *entities.User, webhookID string) (*entities.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByID(ctx, webhookID)
+	if err != nil {
+		if _, ok := err.(*errors.NotFoundError); ok {
+			return nil, err
+		}
+		s.logger.Error("Failed to get webhook",
+			zap.String("webhook_id", webhookID),
+			zap.Error(err),
+		)
+		return nil, errors.NewInternalError("failed to get webhook")
+	}
+
+	// Administrators manage their own webhooks, users theirs.
+	id := ownerID(owner)
+	if (id == nil) != (webhook.OwnerID == nil) || (id != nil && *id != *webhook.OwnerID) {
+		return nil, errors.NewNotFoundError("webhook not found")
+	}
+
+	return webhook, nil
+}
+
+func ownerID(owner *entities.User) *string {
+	if owner == nil {
+		return nil
+	}
+	return &owner.ID
+}
+
+// SignWebhookPayload returns the signature header value for a payload:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<payload>".
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"context"
+	"document-server/internal/domain/services"
+	"document-server/pkg/logger"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+	// BreakerRecovering is the state between a successful probe and the end
+	// of the recovery function, which alone may call Redis meanwhile.
+	BreakerRecovering BreakerState = "recovering"
+)
+
+type BreakerOptions struct {
+	// Timeout bounds every Redis call.
+	Timeout time.Duration
+	// Threshold is how many calls in a row may fail before the breaker
+	// opens.
+	Threshold int
+	// Cooldown is how long the breaker stays open before it lets a probe
+	// through.
+	Cooldown time.Duration
+}
+
+// Breaker guards the calls to Redis with a circuit breaker. After Threshold
+// consecutive failures it opens and fails every call at once with
+// services.ErrCacheUnavailable, so the services fall back to the database
+// instead of waiting on timeouts. After Cooldown a single probe is let
+// through; its success closes the breaker again once the recovery function
+// has run.
+type Breaker struct {
+	client    *RedisCache
+	opts      BreakerOptions
+	onRecover func(ctx context.Context) error
+	recovered chan struct{}
+	logger    *zap.Logger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(client *RedisCache, opts BreakerOptions) *Breaker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 500 * time.Millisecond
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 10 * time.Second
+	}
+
+	return &Breaker{
+		client:    client,
+		opts:      opts,
+		recovered: make(chan struct{}, 1),
+		logger:    logger.Logger,
+		state:     BreakerClosed,
+	}
+}
+
+// recoveryKey marks the context of the recovery function, whose calls the
+// breaker lets through while it keeps every other call out.
+type recoveryKey struct{}
+
+// OnRecover sets a function to run by Run whenever Redis is back after the
+// breaker opened. Writes made during the outage could not invalidate what
+// Redis had cached, so this is where stale entries are dropped: the breaker
+// serves no other calls until fn succeeds through its ctx, and opens again
+// if fn fails.
+func (b *Breaker) OnRecover(fn func(ctx context.Context) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onRecover = fn
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Run probes Redis while the breaker is open, so it closes once Redis is
+// back even when no requests come in, and runs the recovery function. It
+// returns when ctx is done.
+func (b *Breaker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.Cooldown)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b.State() == BreakerOpen {
+				_ = b.call(ctx, b.client.Ping)
+			}
+		case <-b.recovered:
+			b.runRecovery(ctx)
+		}
+	}
+}
+
+// runRecovery runs the recovery function and closes the breaker if it succeeds.
+func (b *Breaker) runRecovery(ctx context.Context) {
+	b.mu.Lock()
+	fn := b.onRecover
+	b.mu.Unlock()
+
+	err := fn(context.WithValue(ctx, recoveryKey{}, b))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerRecovering {
+		// A call of fn failed and opened the breaker.
+		return
+	}
+	if err != nil {
+		b.open(err)
+		return
+	}
+	b.close()
+}
+
+// Probe checks Redis once, opening the breaker right away if it cannot be
+// reached.
+func (b *Breaker) Probe(ctx context.Context) error {
+	callCtx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+
+	if err := b.client.Ping(callCtx); err != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.open(err)
+		return err
+	}
+
+	b.succeed()
+	return nil
+}
+
+func (b *Breaker) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := b.call(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = b.client.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (b *Breaker) Set(ctx context.Context, key string, value any, duration time.Duration) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.client.Set(ctx, key, value, duration)
+	})
+}
+
+func (b *Breaker) SetNX(ctx context.Context, key string, value any, duration time.Duration) (bool, error) {
+	var ok bool
+	err := b.call(ctx, func(ctx context.Context) error {
+		var err error
+		ok, err = b.client.SetNX(ctx, key, value, duration)
+		return err
+	})
+	return ok, err
+}
+
+func (b *Breaker) Del(ctx context.Context, keys ...string) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.client.Del(ctx, keys...)
+	})
+}
+
+// Scan is bounded by ctx rather than the call timeout, as it walks the
+// whole keyspace.
+func (b *Breaker) Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	if !b.allow(ctx) {
+		return services.ErrCacheUnavailable
+	}
+
+	err := b.client.Scan(ctx, match, count, fn)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *Breaker) SMembers(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	err := b.call(ctx, func(ctx context.Context) error {
+		var err error
+		members, err = b.client.SMembers(ctx, key)
+		return err
+	})
+	return members, err
+}
+
+func (b *Breaker) Pipelined(ctx context.Context, fn func(pipe services.RedisPipeliner)) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.client.Pipelined(ctx, fn)
+	})
+}
+
+func (b *Breaker) Publish(ctx context.Context, channel string, message any) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.client.Publish(ctx, channel, message)
+	})
+}
+
+// Subscribe is not guarded: the subscription reconnects by itself once
+// Redis is back.
+func (b *Breaker) Subscribe(ctx context.Context, channel string) <-chan string {
+	return b.client.Subscribe(ctx, channel)
+}
+
+func (b *Breaker) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.allow(ctx) {
+		return services.ErrCacheUnavailable
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+
+	err := fn(callCtx)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	switch {
+	case err == nil, errors.Is(err, services.ErrCacheMiss):
+		b.succeed()
+	case ctx.Err() != nil:
+		// The caller gave up; that says nothing about Redis.
+		b.release()
+	default:
+		b.fail(err)
+	}
+}
+
+// allow reports whether a call may go to Redis. Once the cooldown is over
+// the breaker turns half-open and admits one probe at a time. While it
+// recovers, only the calls of the recovery function are admitted.
+func (b *Breaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.opts.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.logger.Info("Redis circuit breaker half-open, probing")
+		return true
+	case BreakerRecovering:
+		return ctx.Value(recoveryKey{}) == b
+	default:
+		return false
+	}
+}
+
+func (b *Breaker) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	switch {
+	case b.state == BreakerClosed, b.state == BreakerRecovering:
+		return
+	case b.onRecover == nil:
+		b.close()
+		return
+	}
+
+	b.state = BreakerRecovering
+	b.logger.Info("Redis is back, dropping entries cached before the outage")
+	select {
+	case b.recovered <- struct{}{}:
+	default:
+	}
+}
+
+// close closes the breaker; b.mu must be held.
+func (b *Breaker) close() {
+	b.state = BreakerClosed
+	b.logger.Info("Redis circuit breaker closed, Redis is back")
+}
+
+func (b *Breaker) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerClosed && b.failures < b.opts.Threshold {
+		return
+	}
+	b.open(err)
+}
+
+// open trips the breaker; b.mu must be held.
+func (b *Breaker) open(err error) {
+	switch b.state {
+	case BreakerClosed:
+		b.logger.Warn("Redis circuit breaker open, serving without cache",
+			zap.Int("failures", b.failures),
+			zap.Duration("cooldown", b.opts.Cooldown),
+			zap.Error(err),
+		)
+	case BreakerHalfOpen:
+		b.logger.Debug("Redis probe failed, circuit breaker stays open",
+			zap.Error(err),
+		)
+	case BreakerRecovering:
+		b.logger.Warn("Redis recovery failed, circuit breaker open again",
+			zap.Error(err),
+		)
+	}
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+}
+
+// release gives back the probe slot of a call the caller abandoned.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+var (
+	_ services.RedisClient  = (*Breaker)(nil)
+	_ services.PubSubClient = (*Breaker)(nil)
+)
@@ -0,0 +1,368 @@
+package cache
+
+import (
+	"context"
+	"document-server/internal/domain/services"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memorySubscriberBuffer is how many messages a subscriber may fall behind
+// before further ones are dropped, as a slow Redis subscriber would be cut.
+const memorySubscriberBuffer = 256
+
+// MemoryCache is an in-process RedisClient and PubSubClient with the
+// semantics the services rely on: expiring keys, integer counters, sets,
+// SCAN, pipelines and channels. It stands in for Redis in tests and local
+// runs.
+type MemoryCache struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	entries     map[string]*memoryEntry
+	lastSeq     uint64
+	subscribers map[string]map[chan string]struct{}
+}
+
+type memoryEntry struct {
+	// seq orders keys by creation for Scan.
+	seq       uint64
+	value     string
+	set       map[string]struct{}
+	expiresAt time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		now:         time.Now,
+		entries:     make(map[string]*memoryEntry),
+		subscribers: make(map[string]map[chan string]struct{}),
+	}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.lookup(key)
+	if entry == nil {
+		return "", services.ErrCacheMiss
+	}
+	if entry.set != nil {
+		return "", errWrongType(key)
+	}
+	return entry.value, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value any, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(key, value, duration)
+	return nil
+}
+
+func (m *MemoryCache) SetNX(ctx context.Context, key string, value any, duration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lookup(key) != nil {
+		return false, nil
+	}
+	m.set(key, value, duration)
+	return true, nil
+}
+
+func (m *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.del(keys...)
+	return nil
+}
+
+// Scan pages through the live keys in creation order, resuming each page
+// after the last key seen, so deleting keys during a scan does not skip
+// others. Keys written during a scan may be missed, as with Redis.
+func (m *MemoryCache) Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	if count <= 0 {
+		count = 10
+	}
+
+	var cursor uint64
+	for {
+		keys, next := m.scanPage(cursor, match, count)
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// scanPage returns the keys matching match among count keys from sequence
+// number cursor on, and the sequence number of the next page.
+func (m *MemoryCache) scanPage(cursor uint64, match string, count int64) ([]string, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []*memoryEntry
+	keys := make(map[*memoryEntry]string)
+	for key := range m.entries {
+		if entry := m.lookup(key); entry != nil && entry.seq >= cursor {
+			pending = append(pending, entry)
+			keys[entry] = key
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].seq < pending[j].seq
+	})
+
+	var next uint64
+	if int64(len(pending)) > count {
+		next = pending[count].seq
+		pending = pending[:count]
+	}
+
+	var page []string
+	for _, entry := range pending {
+		if key := keys[entry]; match == "" || matchGlob(match, key) {
+			page = append(page, key)
+		}
+	}
+	return page, next
+}
+
+func (m *MemoryCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.lookup(key)
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.set == nil {
+		return nil, errWrongType(key)
+	}
+
+	members := make([]string, 0, len(entry.set))
+	for member := range entry.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// Pipelined applies the commands of fn as one atomic step.
+func (m *MemoryCache) Pipelined(ctx context.Context, fn func(pipe services.RedisPipeliner)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pipe := &memoryPipeliner{cache: m}
+	fn(pipe)
+	return pipe.err
+}
+
+func (m *MemoryCache) Publish(ctx context.Context, channel string, message any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payload := toString(message)
+	for sub := range m.subscribers[channel] {
+		select {
+		case sub <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers the messages published on channel until ctx is done.
+func (m *MemoryCache) Subscribe(ctx context.Context, channel string) <-chan string {
+	sub := make(chan string, memorySubscriberBuffer)
+
+	m.mu.Lock()
+	if m.subscribers[channel] == nil {
+		m.subscribers[channel] = make(map[chan string]struct{})
+	}
+	m.subscribers[channel][sub] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers[channel], sub)
+		close(sub)
+	}()
+
+	return sub
+}
+
+// lookup returns the live entry of key, dropping it if it has expired.
+func (m *MemoryCache) lookup(key string) *memoryEntry {
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (m *MemoryCache) set(key string, value any, duration time.Duration) {
+	entry := m.create(key)
+	entry.value = toString(value)
+	if duration > 0 {
+		entry.expiresAt = m.now().Add(duration)
+	}
+}
+
+// create stores a new empty entry at key, replacing any previous one.
+func (m *MemoryCache) create(key string) *memoryEntry {
+	m.lastSeq++
+	entry := &memoryEntry{seq: m.lastSeq}
+	m.entries[key] = entry
+	return entry
+}
+
+func (m *MemoryCache) del(keys ...string) {
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+}
+
+type memoryPipeliner struct {
+	cache *MemoryCache
+	err   error
+}
+
+func (p *memoryPipeliner) Set(key string, value any, duration time.Duration) {
+	p.cache.set(key, value, duration)
+}
+
+func (p *memoryPipeliner) Incr(key string) {
+	entry := p.cache.lookup(key)
+	if entry == nil {
+		entry = p.cache.create(key)
+		entry.value = "0"
+	}
+	if entry.set != nil {
+		p.fail(errWrongType(key))
+		return
+	}
+
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		p.fail(fmt.Errorf("value of %s is not an integer", key))
+		return
+	}
+	entry.value = strconv.FormatInt(n+1, 10)
+}
+
+func (p *memoryPipeliner) Expire(key string, duration time.Duration) {
+	if entry := p.cache.lookup(key); entry != nil {
+		entry.expiresAt = p.cache.now().Add(duration)
+	}
+}
+
+func (p *memoryPipeliner) SAdd(key string, members ...string) {
+	entry := p.cache.lookup(key)
+	if entry == nil {
+		entry = p.cache.create(key)
+		entry.set = make(map[string]struct{})
+	}
+	if entry.set == nil {
+		p.fail(errWrongType(key))
+		return
+	}
+
+	for _, member := range members {
+		entry.set[member] = struct{}{}
+	}
+}
+
+func (p *memoryPipeliner) SRem(key string, members ...string) {
+	entry := p.cache.lookup(key)
+	if entry == nil {
+		return
+	}
+	if entry.set == nil {
+		p.fail(errWrongType(key))
+		return
+	}
+
+	for _, member := range members {
+		delete(entry.set, member)
+	}
+	if len(entry.set) == 0 {
+		delete(p.cache.entries, key)
+	}
+}
+
+func (p *memoryPipeliner) Unlink(keys ...string) {
+	p.cache.del(keys...)
+}
+
+// fail records the first error of the pipeline; like Redis, the other
+// commands still run.
+func (p *memoryPipeliner) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func errWrongType(key string) error {
+	return fmt.Errorf("key %s holds the wrong kind of value", key)
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// matchGlob reports whether key matches pattern, where * matches any run of
+// characters and ? any single one, as in Redis patterns without classes.
+func matchGlob(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(key); i >= 0; i-- {
+				if matchGlob(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+var (
+	_ services.RedisClient  = (*MemoryCache)(nil)
+	_ services.PubSubClient = (*MemoryCache)(nil)
+)
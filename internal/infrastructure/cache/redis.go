@@ -2,35 +2,109 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"document-server/internal/config"
 	"document-server/internal/domain/services"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
+// RedisCache talks to a single node, a Sentinel-managed master or a Cluster,
+// depending on the configuration.
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
+// NewRedisCache does not connect: connections are made on use, so the
+// server can start while Redis is down. It fails only on invalid settings.
+//
+// With a master name the addresses are those of the sentinels; otherwise
+// several addresses, or cluster set, mean a Cluster seeded from them.
 func NewRedisCache(cfg config.RedisConfig) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	addrs := cfg.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{cfg.Addr}
+	}
+
+	tlsConfig, err := redisTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            addrs,
+		MasterName:       cfg.MasterName,
+		IsClusterMode:    cfg.Cluster,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		TLSConfig:        tlsConfig,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		PoolTimeout:      cfg.PoolTimeout,
+		ConnMaxIdleTime:  cfg.ConnMaxIdleTime,
+		// Calls are bounded by their context, which the breaker sets.
+		ContextTimeoutEnabled: true,
+	})
 
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	// Command arguments carry cached documents and session keys, so spans
+	// name the commands only.
+	if err := redisotel.InstrumentTracing(client, redisotel.WithDBStatement(false)); err != nil {
+		return nil, fmt.Errorf("instrument Redis tracing: %w", err)
 	}
 
 	return &RedisCache{client: client}, nil
 }
 
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in Redis CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (r *RedisCache) Ping(ctx context.Context) error {
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return nil
+}
+
 func (r *RedisCache) Close() error {
 	return r.client.Close()
 }
@@ -38,6 +112,9 @@ func (r *RedisCache) Close() error {
 func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	result := r.client.Get(ctx, key)
 	if result.Err() != nil {
+		if errors.Is(result.Err(), redis.Nil) {
+			return "", services.ErrCacheMiss
+		}
 		return "", result.Err()
 	}
 	return result.Val(), nil
@@ -47,16 +124,143 @@ func (r *RedisCache) Set(ctx context.Context, key string, value any, duration ti
 	return r.client.Set(ctx, key, value, duration).Err()
 }
 
+func (r *RedisCache) SetNX(ctx context.Context, key string, value any, duration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, duration).Result()
+}
+
 func (r *RedisCache) Del(ctx context.Context, keys ...string) error {
 	return r.client.Del(ctx, keys...).Err()
 }
 
-func (r *RedisCache) Keys(ctx context.Context, pattern string) ([]string, error) {
-	result := r.client.Keys(ctx, pattern)
-	if result.Err() != nil {
-		return nil, result.Err()
+// Scan walks every master of a Cluster, since SCAN only covers the node it
+// is sent to.
+func (r *RedisCache) Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node, match, count, fn)
+		})
 	}
-	return result.Val(), nil
+	return scanNode(ctx, r.client, match, count, fn)
 }
 
-var _ services.RedisClient = (*RedisCache)(nil)
+func scanNode(ctx context.Context, node redis.Cmdable, match string, count int64, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (r *RedisCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	return r.client.SMembers(ctx, key).Result()
+}
+
+func (r *RedisCache) Pipelined(ctx context.Context, fn func(pipe services.RedisPipeliner)) error {
+	_, cluster := r.client.(*redis.ClusterClient)
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		fn(&redisPipeliner{ctx: ctx, pipe: pipe, cluster: cluster})
+		return nil
+	})
+	return err
+}
+
+// redisPipeliner queues commands on a go-redis pipeline; their errors are
+// reported by Pipelined.
+type redisPipeliner struct {
+	ctx     context.Context
+	pipe    redis.Pipeliner
+	cluster bool
+}
+
+func (p *redisPipeliner) Set(key string, value any, duration time.Duration) {
+	p.pipe.Set(p.ctx, key, value, duration)
+}
+
+func (p *redisPipeliner) Incr(key string) {
+	p.pipe.Incr(p.ctx, key)
+}
+
+func (p *redisPipeliner) Expire(key string, duration time.Duration) {
+	p.pipe.Expire(p.ctx, key, duration)
+}
+
+func (p *redisPipeliner) SAdd(key string, members ...string) {
+	p.pipe.SAdd(p.ctx, key, toAny(members)...)
+}
+
+func (p *redisPipeliner) SRem(key string, members ...string) {
+	p.pipe.SRem(p.ctx, key, toAny(members)...)
+}
+
+// Unlink sends a command per key to a Cluster, where keys of different hash
+// slots cannot go in one command.
+func (p *redisPipeliner) Unlink(keys ...string) {
+	if !p.cluster {
+		p.pipe.Unlink(p.ctx, keys...)
+		return
+	}
+	for _, key := range keys {
+		p.pipe.Unlink(p.ctx, key)
+	}
+}
+
+func toAny(values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func (r *RedisCache) Publish(ctx context.Context, channel string, message any) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe forwards the messages on channel until ctx is done. The
+// subscription reconnects by itself if the connection drops.
+func (r *RedisCache) Subscribe(ctx context.Context, channel string) <-chan string {
+	pubsub := r.client.Subscribe(ctx, channel)
+	messages := make(chan string)
+
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		incoming := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-incoming:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages
+}
+
+var (
+	_ services.RedisClient  = (*RedisCache)(nil)
+	_ services.PubSubClient = (*RedisCache)(nil)
+)
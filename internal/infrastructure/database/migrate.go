@@ -0,0 +1,155 @@
+package database
+
+import (
+	"document-server/internal/config"
+	"document-server/migrations"
+	"document-server/pkg/logger"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// ErrSchemaNewer is returned for a database migrated past the newest
+// migration this build embeds: a newer release has run against it.
+var ErrSchemaNewer = errors.New("database schema is newer than this build")
+
+type MigrationStatus struct {
+	// Version is 0 when no migration has been applied.
+	Version uint64
+	Dirty   bool
+	Latest  uint64
+	Pending int
+}
+
+// Migrator applies the embedded migrations with golang-migrate, keeping its
+// schema_migrations table, so databases migrated with the migrate CLI carry
+// on. golang-migrate holds a Postgres advisory lock while it migrates, so
+// replicas starting together apply each migration once.
+type Migrator struct {
+	migrate  *migrate.Migrate
+	versions []uint64
+}
+
+func NewMigrator(cfg config.DatabaseConfig) (*Migrator, error) {
+	versions, err := migrations.Versions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	connConfig, err := pgx.ParseConfig(dsn(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	db := stdlib.OpenDB(*connConfig)
+
+	driver, err := pgxmigrate.WithInstance(db, &pgxmigrate.Config{})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "pgx5", driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	m.Log = migrateLogger{}
+	if cfg.MigrateLockTimeout > 0 {
+		m.LockTimeout = cfg.MigrateLockTimeout
+	}
+
+	return &Migrator{migrate: m, versions: versions}, nil
+}
+
+func (m *Migrator) Status() (MigrationStatus, error) {
+	status := MigrationStatus{}
+	if len(m.versions) > 0 {
+		status.Latest = m.versions[len(m.versions)-1]
+	}
+
+	version, dirty, err := m.migrate.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+	case err != nil:
+		return status, err
+	default:
+		status.Version, status.Dirty = uint64(version), dirty
+	}
+
+	for _, v := range m.versions {
+		if v > status.Version {
+			status.Pending++
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration. It refuses a schema newer than the
+// embedded migrations rather than run the code of an older release on it.
+func (m *Migrator) Up() error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	if status.Version > status.Latest {
+		return fmt.Errorf("%w: schema at version %d, newest migration is %d", ErrSchemaNewer, status.Version, status.Latest)
+	}
+
+	if err := m.migrate.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down reverts the last steps migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	if err := m.migrate.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// DownAll reverts every applied migration.
+func (m *Migrator) DownAll() error {
+	if err := m.migrate.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Force records version as applied and clears the dirty flag without
+// running anything, after a failed migration was repaired by hand. A
+// version of -1 records that no migration is applied.
+func (m *Migrator) Force(version int) error {
+	return m.migrate.Force(version)
+}
+
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.migrate.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// migrateLogger reports the progress of golang-migrate through the server
+// logger.
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...any) {
+	logger.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"document-server/internal/config"
+	"document-server/internal/infrastructure/tracing"
 	"fmt"
 	"time"
 
@@ -14,12 +15,7 @@ type PostgresDB struct {
 }
 
 func NewPostgresDB(cfg config.DatabaseConfig) (*PostgresDB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode,
-	)
-
-	config, err := pgxpool.ParseConfig(dsn)
+	config, err := pgxpool.ParseConfig(dsn(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database config: %w", err)
 	}
@@ -28,6 +24,7 @@ func NewPostgresDB(cfg config.DatabaseConfig) (*PostgresDB, error) {
 	config.MinConns = 5
 	config.MaxConnLifetime = 5 * time.Minute
 	config.MaxConnIdleTime = 1 * time.Minute
+	config.ConnConfig.Tracer = tracing.NewQueryTracer()
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
@@ -41,6 +38,13 @@ func NewPostgresDB(cfg config.DatabaseConfig) (*PostgresDB, error) {
 	return &PostgresDB{pool: pool}, nil
 }
 
+func dsn(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode,
+	)
+}
+
 func (p *PostgresDB) Pool() *pgxpool.Pool {
 	return p.pool
 }
@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/pkg/auditchain"
+	appErrors "document-server/pkg/errors"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	auditColumns      = `id, actor, action, target_type, target_id, ip, user_agent, outcome, detail, created_at, prev_hash, hash`
+	checkpointColumns = `id, event_id, hash, signature, created_at`
+
+	// auditChainLockKey serialises appends so that every event links to the
+	// one inserted before it.
+	auditChainLockKey = 0x6175646974 // "audit"
+)
+
+type auditRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(pool *pgxpool.Pool) repositories.AuditRepository {
+	return &auditRepository{pool: pool}
+}
+
+func (r *auditRepository) Create(ctx context.Context, event *entities.AuditEvent) error {
+	return r.CreateBatch(ctx, []*entities.AuditEvent{event})
+}
+
+// CreateBatch appends events in order under a single hold of the chain lock.
+func (r *auditRepository) CreateBatch(ctx context.Context, events []*entities.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return appErrors.NewInternalError("failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLockKey); err != nil {
+		return appErrors.NewInternalError("failed to lock audit chain")
+	}
+
+	var prevHash []byte
+	err = tx.QueryRow(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return appErrors.NewInternalError("failed to read audit chain head")
+	}
+
+	query := `INSERT INTO audit_events (id, actor, action, target_type, target_id, ip, user_agent, outcome, detail, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	for _, event := range events {
+		// The timestamp comes from the database clock, which the NOW() defaults
+		// of every other table use, and is read under the chain lock so that
+		// created_at follows the chain order. It is hashed exactly as stored.
+		err := tx.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('audit_events', 'id')), clock_timestamp()::timestamp`).
+			Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return appErrors.NewInternalError("failed to allocate audit event id")
+		}
+
+		event.PrevHash = prevHash
+		event.Hash = auditchain.Hash(prevHash, event.ChainFields()...)
+
+		_, err = tx.Exec(ctx, query,
+			event.ID, event.Actor, event.Action, event.TargetType, event.TargetID,
+			event.IP, event.UserAgent, event.Outcome, event.Detail, event.CreatedAt,
+			event.PrevHash, event.Hash,
+		)
+		if err != nil {
+			return appErrors.NewInternalError("audit event insert failed")
+		}
+		prevHash = event.Hash
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.NewInternalError("failed to commit audit event")
+	}
+	return nil
+}
+
+// List returns the events matching filter, newest first.
+func (r *auditRepository) List(ctx context.Context, filter *entities.AuditFilter) ([]*entities.AuditEvent, error) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		add("target_id = $%d", filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		add("outcome = $%d", filter.Outcome)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at < $%d", *filter.To)
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, appErrors.NewInternalError("audit query failed")
+	}
+	defer rows.Close()
+
+	var events []*entities.AuditEvent
+	for rows.Next() {
+		var event entities.AuditEvent
+		if err := scanAuditEvent(rows, &event); err != nil {
+			return nil, appErrors.NewInternalError("failed to scan audit event")
+		}
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return events, nil
+}
+
+func (r *auditRepository) DeleteOlderThan(ctx context.Context, age time.Duration) (int64, error) {
+	// The cutoff is computed by the database, like the trigger's: "1 year"
+	// is 366 days after a leap day, which a fixed duration cannot match.
+	query := `DELETE FROM audit_events
+		WHERE created_at < LEAST(NOW() - make_interval(secs => $1::double precision), NOW() - INTERVAL '1 year')`
+
+	result, err := r.pool.Exec(ctx, query, age.Seconds())
+	if err != nil {
+		return 0, appErrors.NewInternalError("audit purge failed")
+	}
+	return result.RowsAffected(), nil
+}
+
+func (r *auditRepository) Walk(ctx context.Context, fn func(event *entities.AuditEvent) error) error {
+	query := `SELECT ` + auditColumns + ` FROM audit_events ORDER BY id ASC`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return appErrors.NewInternalError("audit query failed")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event entities.AuditEvent
+		if err := scanAuditEvent(rows, &event); err != nil {
+			return appErrors.NewInternalError("failed to scan audit event")
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return appErrors.NewInternalError("rows iteration error")
+	}
+
+	return nil
+}
+
+func (r *auditRepository) LatestEvent(ctx context.Context) (*entities.AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events ORDER BY id DESC LIMIT 1`
+
+	var event entities.AuditEvent
+	if err := scanAuditEvent(r.pool.QueryRow(ctx, query), &event); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("no audit events")
+		}
+		return nil, appErrors.NewInternalError("audit query failed")
+	}
+	return &event, nil
+}
+
+func (r *auditRepository) CreateCheckpoint(ctx context.Context, checkpoint *entities.AuditCheckpoint) error {
+	query := `INSERT INTO audit_checkpoints (event_id, hash, signature) VALUES ($1, $2, $3) RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query, checkpoint.EventID, checkpoint.Hash, checkpoint.Signature).
+		Scan(&checkpoint.ID, &checkpoint.CreatedAt)
+	if err != nil {
+		return appErrors.NewInternalError("audit checkpoint insert failed")
+	}
+	return nil
+}
+
+func (r *auditRepository) LatestCheckpoint(ctx context.Context) (*entities.AuditCheckpoint, error) {
+	query := `SELECT ` + checkpointColumns + ` FROM audit_checkpoints ORDER BY event_id DESC, id DESC LIMIT 1`
+
+	var checkpoint entities.AuditCheckpoint
+	if err := scanCheckpoint(r.pool.QueryRow(ctx, query), &checkpoint); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("no audit checkpoints")
+		}
+		return nil, appErrors.NewInternalError("audit checkpoint query failed")
+	}
+	return &checkpoint, nil
+}
+
+func (r *auditRepository) ListCheckpoints(ctx context.Context) ([]*entities.AuditCheckpoint, error) {
+	query := `SELECT ` + checkpointColumns + ` FROM audit_checkpoints ORDER BY event_id ASC, id ASC`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, appErrors.NewInternalError("audit checkpoint query failed")
+	}
+	defer rows.Close()
+
+	var checkpoints []*entities.AuditCheckpoint
+	for rows.Next() {
+		var checkpoint entities.AuditCheckpoint
+		if err := scanCheckpoint(rows, &checkpoint); err != nil {
+			return nil, appErrors.NewInternalError("failed to scan audit checkpoint")
+		}
+		checkpoints = append(checkpoints, &checkpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return checkpoints, nil
+}
+
+func scanAuditEvent(row pgx.Row, event *entities.AuditEvent) error {
+	return row.Scan(
+		&event.ID, &event.Actor, &event.Action, &event.TargetType, &event.TargetID,
+		&event.IP, &event.UserAgent, &event.Outcome, &event.Detail, &event.CreatedAt,
+		&event.PrevHash, &event.Hash,
+	)
+}
+
+func scanCheckpoint(row pgx.Row, checkpoint *entities.AuditCheckpoint) error {
+	return row.Scan(
+		&checkpoint.ID, &checkpoint.EventID, &checkpoint.Hash,
+		&checkpoint.Signature, &checkpoint.CreatedAt,
+	)
+}
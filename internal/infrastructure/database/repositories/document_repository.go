@@ -5,11 +5,14 @@ import (
 	"document-server/internal/domain/entities"
 	"document-server/internal/domain/repositories"
 	appErrors "document-server/pkg/errors"
+	"document-server/pkg/jsonpatch"
 	"document-server/pkg/logger"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -17,32 +20,87 @@ import (
 )
 
 type documentRepository struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
+	pool *pgxpool.Pool
 }
 
 func NewDocumentRepository(pool *pgxpool.Pool) repositories.DocumentRepository {
-	return &documentRepository{
-		pool:   pool,
-		logger: logger.Logger,
-	}
+	return &documentRepository{pool: pool}
 }
 
 const (
-	baseSelectQuery = `SELECT id, name, owner_id, mime, is_file, is_public, file_path, json_data, "grant", created_at, updated_at FROM documents`
-	insertQuery     = `INSERT INTO documents (name, owner_id, mime, is_file, is_public, file_path, json_data, "grant") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at, updated_at`
-	deleteQuery = `DELETE FROM documents WHERE id = $1`
+	// liveLockColumns return a lock only while it is live. Expiry is judged
+	// by the database clock: lock_expires_at has no time zone, so comparing
+	// it with the server clock would be off by the zone difference.
+	liveLockColumns = `CASE WHEN lock_expires_at > NOW() THEN lock_holder END,
+		CASE WHEN lock_expires_at > NOW() THEN lock_acquired_at END,
+		CASE WHEN lock_expires_at > NOW() THEN lock_expires_at END`
+	documentColumns = `id, name, owner_id, mime, is_file, is_public, file_path, json_data, "grant", schema_id, version,
+		` + liveLockColumns + `, created_at, updated_at`
+	baseSelectQuery = `SELECT ` + documentColumns + ` FROM documents`
+	insertQuery     = `INSERT INTO documents (name, owner_id, mime, is_file, is_public, file_path, json_data, "grant", schema_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, version, created_at, updated_at`
+	updateJSONQuery = `UPDATE documents SET json_data = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND ($3::bigint = 0 OR version = $3) AND (lock_holder IS NULL OR lock_expires_at <= NOW() OR lock_holder = $4)
+		RETURNING ` + documentColumns
+	updateContentQuery = `UPDATE documents SET name = $1, mime = $2, file_path = $3, json_data = $4, schema_id = $5, version = version + 1, updated_at = NOW()
+		WHERE id = $6 AND ($7::bigint = 0 OR version = $7) AND (lock_holder IS NULL OR lock_expires_at <= NOW() OR lock_holder = $8)
+		RETURNING ` + documentColumns
+	updateAccessQuery = `UPDATE documents SET is_public = $1, "grant" = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $3 AND ($4::bigint = 0 OR version = $4) AND (lock_holder IS NULL OR lock_expires_at <= NOW() OR lock_holder = $5)
+		RETURNING ` + documentColumns
+	deleteQuery = `DELETE FROM documents WHERE id = $1 AND ($2::bigint = 0 OR version = $2) AND (lock_holder IS NULL OR lock_expires_at <= NOW() OR lock_holder = $3)
+		RETURNING ` + documentColumns
+	accessForUpdateQuery = `SELECT is_public, "grant" FROM documents WHERE id = $1 FOR UPDATE`
+
+	// Lock changes do not bump the version: a lease says who may write, it
+	// is not part of the content.
+	acquireLockQuery = `UPDATE documents SET lock_holder = $2,
+		lock_acquired_at = CASE WHEN lock_holder = $2 AND lock_expires_at > NOW() THEN lock_acquired_at ELSE NOW() END,
+		lock_expires_at = NOW() + make_interval(secs => $3::double precision)
+		WHERE id = $1 AND (lock_holder IS NULL OR lock_expires_at <= NOW() OR lock_holder = $2)
+		RETURNING ` + documentColumns
+	refreshLockQuery = `UPDATE documents SET lock_expires_at = NOW() + make_interval(secs => $3::double precision)
+		WHERE id = $1 AND lock_holder = $2 AND lock_expires_at > NOW()
+		RETURNING ` + documentColumns
+	releaseLockQuery = `UPDATE documents SET lock_holder = NULL, lock_acquired_at = NULL, lock_expires_at = NULL
+		WHERE id = $1 AND ($3::boolean OR (lock_holder = $2 AND lock_expires_at > NOW()))
+		RETURNING ` + documentColumns
+	lockStateQuery  = `SELECT ` + liveLockColumns + ` FROM documents WHERE id = $1`
+	writeStateQuery = `SELECT lock_holder, lock_expires_at > NOW() FROM documents WHERE id = $1`
+
+	setSimilarityThresholdQuery = `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`
+
+	changeColumns     = `seq, doc_id, op, name, owner_id, mime, is_file, is_public, "grant", prev_public, prev_grant, version, changed_at`
+	appendChangeQuery = `INSERT INTO document_changes (doc_id, op, name, owner_id, mime, is_file, is_public, "grant", prev_public, prev_grant, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	listChangesQuery = `SELECT ` + changeColumns + ` FROM document_changes
+		WHERE seq > $1 AND (owner_id = $2 OR is_public OR prev_public OR $3 = ANY("grant") OR $3 = ANY(prev_grant))
+		ORDER BY seq ASC LIMIT $4`
+
+	// changeLogLockKey serialises appends to the change log so that seq
+	// order is commit order and a reader never skips a late commit. It is
+	// taken last in every write transaction, see recordWrite.
+	changeLogLockKey = 0x6368616e676573 // "changes"
 )
 
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
 func (r *documentRepository) Create(ctx context.Context, doc *entities.Document) error {
-	err := r.pool.QueryRow(ctx, insertQuery,
-		doc.Name, doc.OwnerID, doc.MIME, doc.IsFile,
-		doc.IsPublic, doc.FilePath, doc.JSONData, doc.Grant,
-	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, insertQuery,
+			doc.Name, doc.OwnerID, doc.MIME, doc.IsFile,
+			doc.IsPublic, doc.FilePath, doc.JSONData, doc.Grant, doc.SchemaID,
+		).Scan(&doc.ID, &doc.Version, &doc.CreatedAt, &doc.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return r.recordWrite(ctx, tx, entities.MutationCreated, "", doc, nil)
+	})
 
 	if err != nil {
-		r.logger.Error("Database operation failed",
+		logger.FromContext(ctx).Error("Database operation failed",
 			zap.String("operation", "create_document"),
 			zap.String("owner_id", doc.OwnerID),
 			zap.Error(err),
@@ -55,16 +113,13 @@ func (r *documentRepository) Create(ctx context.Context, doc *entities.Document)
 
 func (r *documentRepository) GetByID(ctx context.Context, id string) (*entities.Document, error) {
 	var doc entities.Document
-	err := r.pool.QueryRow(ctx, baseSelectQuery+" WHERE id = $1", id).Scan(
-		&doc.ID, &doc.Name, &doc.OwnerID, &doc.MIME, &doc.IsFile, &doc.IsPublic,
-		&doc.FilePath, &doc.JSONData, &doc.Grant, &doc.CreatedAt, &doc.UpdatedAt,
-	)
+	err := scanDocument(r.pool.QueryRow(ctx, baseSelectQuery+" WHERE id = $1", id), &doc)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, appErrors.NewNotFoundError("document not found")
 		}
-		r.logger.Error("Database operation failed",
+		logger.FromContext(ctx).Error("Database operation failed",
 			zap.String("operation", "get_document_by_id"),
 			zap.String("doc_id", id),
 			zap.Error(err),
@@ -75,6 +130,29 @@ func (r *documentRepository) GetByID(ctx context.Context, id string) (*entities.
 	return &doc, nil
 }
 
+func (r *documentRepository) GetByIDProjected(ctx context.Context, id string, projection *entities.JSONProjection) (*entities.Document, error) {
+	columns, args, argIndex := projectedColumns(projection.Paths(), 1)
+	query := fmt.Sprintf("SELECT %s FROM documents WHERE id = $%d", columns, argIndex)
+	args = append(args, id)
+
+	var doc entities.Document
+	err := scanProjectedDocument(r.pool.QueryRow(ctx, query, args...), &doc, projection)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("document not found")
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "get_document_projection"),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("database query failed")
+	}
+
+	return &doc, nil
+}
+
 func (r *documentRepository) GetByOwner(ctx context.Context, filter *entities.DocumentFilter) ([]*entities.Document, error) {
 	if filter == nil {
 		return nil, appErrors.NewBadRequestError("filter cannot be nil")
@@ -82,70 +160,522 @@ func (r *documentRepository) GetByOwner(ctx context.Context, filter *entities.Do
 
 	query, args := r.buildFilterQuery(filter)
 
-	rows, err := r.pool.Query(ctx, query, args...)
+	var threshold *float64
+	if filter.Mode == entities.SearchModeSimilar {
+		threshold = filter.Threshold
+	}
+
+	var docs []*entities.Document
+	err := r.withSimilarityThreshold(ctx, threshold, func(q querier) error {
+		rows, err := q.Query(ctx, query, args...)
+		if err != nil {
+			logger.FromContext(ctx).Error("Database operation failed",
+				zap.String("operation", "get_documents_by_owner"),
+				zap.String("owner_id", filter.OwnerID),
+				zap.Error(err),
+			)
+			return appErrors.NewInternalError("failed to query documents")
+		}
+		defer rows.Close()
+
+		var projection *entities.JSONProjection
+		if len(filter.Fields) > 0 {
+			projection = &entities.JSONProjection{Fields: filter.Fields}
+		}
+
+		docs, err = r.scanDocuments(ctx, rows, projection)
+		return err
+	})
 	if err != nil {
-		r.logger.Error("Database operation failed",
-			zap.String("operation", "get_documents_by_owner"),
-			zap.String("owner_id", filter.OwnerID),
-			zap.Error(err),
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+func (r *documentRepository) SuggestNames(ctx context.Context, filter *entities.SuggestFilter) ([]string, error) {
+	if filter == nil || filter.Query == "" {
+		return nil, appErrors.NewBadRequestError("query cannot be empty")
+	}
+
+	condition, orderBy, args, argIndex := r.buildKeyValueFilter("name", filter.Query, entities.SearchModeSimilar, 1)
+	prefixIndex := argIndex
+	args = append(args, escapeLike(filter.Query)+"%", filter.UserID, filter.UserLogin, filter.Limit)
+
+	query := fmt.Sprintf(
+		`SELECT name FROM documents
+		WHERE (%s OR name ILIKE $%d ESCAPE '\')
+			AND (owner_id = $%d OR is_public OR $%d = ANY("grant"))
+		GROUP BY name
+		ORDER BY name ILIKE $%d ESCAPE '\' DESC, %s DESC, name ASC
+		LIMIT $%d`,
+		condition, prefixIndex, prefixIndex+1, prefixIndex+2, prefixIndex, orderBy, prefixIndex+3,
+	)
+
+	log := logger.FromContext(ctx)
+
+	var names []string
+	var threshold *float64
+	if filter.Threshold > 0 {
+		threshold = &filter.Threshold
+	}
+
+	err := r.withSimilarityThreshold(ctx, threshold, func(q querier) error {
+		rows, err := q.Query(ctx, query, args...)
+		if err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "suggest_document_names"),
+				zap.String("user_id", filter.UserID),
+				zap.Error(err),
+			)
+			return appErrors.NewInternalError("failed to query document names")
+		}
+		defer rows.Close()
+
+		names, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "scan_document_names"),
+				zap.Error(err),
+			)
+			return appErrors.NewInternalError("failed to scan document names")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Aggregate groups the documents matched by the query filter that the
+// requesting user can see. Access is checked in SQL with the same rules as
+// the list endpoint: public, owned or shared via grant.
+func (r *documentRepository) Aggregate(ctx context.Context, query *entities.AggregateQuery) ([]*entities.AggregateBucket, error) {
+	if query == nil {
+		return nil, appErrors.NewBadRequestError("query cannot be nil")
+	}
+
+	conditions, _, args, argIndex := r.buildFilterConditions(&query.Filter, nil, 1)
+
+	conditions = append(conditions, fmt.Sprintf(
+		`(is_public OR $%d = ANY("grant") OR owner_id IN (SELECT id FROM users WHERE login = $%d))`,
+		argIndex, argIndex,
+	))
+	args = append(args, query.Filter.RequestingUserLogin)
+	argIndex++
+
+	var keyExpr, orderBy string
+	switch query.GroupBy {
+	case entities.GroupByJSON:
+		keyExpr = fmt.Sprintf("json_data #>> $%d::text[]", argIndex)
+		// The top-level key check lets Postgres use the GIN index on json_data.
+		conditions = append(conditions,
+			fmt.Sprintf("json_data ? $%d", argIndex+1),
+			fmt.Sprintf("json_data #> $%d::text[] IS NOT NULL", argIndex),
 		)
-		return nil, appErrors.NewInternalError("failed to query documents")
+		args = append(args, []string(query.GroupPath), query.GroupPath[0])
+		argIndex += 2
+		orderBy = "count DESC, key ASC"
+	case entities.GroupByMIME:
+		keyExpr = "mime"
+		orderBy = "count DESC, key ASC"
+	case entities.GroupByOwner:
+		keyExpr = "(SELECT login FROM users WHERE users.id = documents.owner_id)"
+		orderBy = "count DESC, key ASC"
+	case entities.GroupByCreatedAt:
+		keyExpr = fmt.Sprintf("to_char(date_trunc($%d, created_at), 'YYYY-MM-DD')", argIndex)
+		args = append(args, query.Bucket)
+		argIndex++
+		orderBy = "key ASC"
+	default:
+		return nil, appErrors.NewBadRequestError("unsupported group_by")
 	}
-	defer rows.Close()
 
-	docs, err := r.scanDocuments(rows)
+	valueExpr := "COUNT(*)::float8"
+	if query.Metric != entities.AggregateCount {
+		numeric := fmt.Sprintf(
+			"CASE WHEN jsonb_typeof(json_data #> $%d::text[]) = 'number' THEN (json_data #>> $%d::text[])::numeric END",
+			argIndex, argIndex,
+		)
+		args = append(args, []string(query.Field))
+		argIndex++
+		valueExpr = fmt.Sprintf("%s(%s)::float8", strings.ToUpper(query.Metric), numeric)
+	}
+
+	sql := fmt.Sprintf(
+		"SELECT %s AS key, COUNT(*) AS count, %s AS value FROM documents WHERE %s GROUP BY 1 ORDER BY %s",
+		keyExpr, valueExpr, strings.Join(conditions, " AND "), orderBy,
+	)
+	if query.Filter.Limit > 0 {
+		sql += fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, query.Filter.Limit)
+	}
+
+	var threshold *float64
+	if query.Filter.Mode == entities.SearchModeSimilar {
+		threshold = query.Filter.Threshold
+	}
+
+	log := logger.FromContext(ctx)
+
+	var buckets []*entities.AggregateBucket
+	err := r.withSimilarityThreshold(ctx, threshold, func(q querier) error {
+		rows, err := q.Query(ctx, sql, args...)
+		if err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "aggregate_documents"),
+				zap.String("group_by", query.GroupBy),
+				zap.String("metric", query.Metric),
+				zap.Error(err),
+			)
+			return appErrors.NewInternalError("failed to aggregate documents")
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			bucket := &entities.AggregateBucket{}
+			if err := rows.Scan(&bucket.Key, &bucket.Count, &bucket.Value); err != nil {
+				log.Error("Database operation failed",
+					zap.String("operation", "scan_aggregate_row"),
+					zap.Error(err),
+				)
+				return appErrors.NewInternalError("failed to scan aggregate")
+			}
+			buckets = append(buckets, bucket)
+		}
+
+		if err := rows.Err(); err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "iterate_rows"),
+				zap.Error(err),
+			)
+			return appErrors.NewInternalError("rows iteration error")
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return docs, nil
+	return buckets, nil
 }
 
-func (r *documentRepository) Delete(ctx context.Context, id string) error {
-	result, err := r.pool.Exec(ctx, deleteQuery, id)
+func (r *documentRepository) UpdateJSON(ctx context.Context, id string, data *json.RawMessage, cond entities.WriteCondition) (*entities.Document, error) {
+	var doc entities.Document
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		if err := scanDocument(tx.QueryRow(ctx, updateJSONQuery, data, id, cond.ExpectedVersion, cond.Actor), &doc); err != nil {
+			return err
+		}
+		return r.recordWrite(ctx, tx, entities.MutationUpdated, cond.Actor, &doc, nil)
+	})
+
 	if err != nil {
-		r.logger.Error("Database operation failed",
-			zap.String("operation", "delete_document"),
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, r.rejectedWrite(ctx, id, cond)
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "update_document_json"),
 			zap.String("doc_id", id),
 			zap.Error(err),
 		)
+		return nil, r.wrapError(err)
+	}
+
+	return &doc, nil
+}
+
+func (r *documentRepository) UpdateContent(ctx context.Context, doc *entities.Document, cond entities.WriteCondition) error {
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		err := scanDocument(tx.QueryRow(ctx, updateContentQuery,
+			doc.Name, doc.MIME, doc.FilePath, doc.JSONData, doc.SchemaID, doc.ID, cond.ExpectedVersion, cond.Actor,
+		), doc)
+		if err != nil {
+			return err
+		}
+		return r.recordWrite(ctx, tx, entities.MutationUpdated, cond.Actor, doc, nil)
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r.rejectedWrite(ctx, doc.ID, cond)
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "update_document_content"),
+			zap.String("doc_id", doc.ID),
+			zap.Error(err),
+		)
 		return r.wrapError(err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return appErrors.NewNotFoundError("document not found")
+	return nil
+}
+
+func (r *documentRepository) UpdateAccess(ctx context.Context, id string, isPublic bool, grant []string, cond entities.WriteCondition) (*entities.Document, error) {
+	var doc entities.Document
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		var prev entities.Document
+		if err := tx.QueryRow(ctx, accessForUpdateQuery, id).Scan(&prev.IsPublic, &prev.Grant); err != nil {
+			return err
+		}
+		if err := scanDocument(tx.QueryRow(ctx, updateAccessQuery, isPublic, grant, id, cond.ExpectedVersion, cond.Actor), &doc); err != nil {
+			return err
+		}
+		return r.recordWrite(ctx, tx, entities.MutationAccess, cond.Actor, &doc, &prev)
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, r.rejectedWrite(ctx, id, cond)
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "update_document_access"),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return nil, r.wrapError(err)
+	}
+
+	return &doc, nil
+}
+
+func (r *documentRepository) Delete(ctx context.Context, id string, cond entities.WriteCondition) error {
+	err := r.inTx(ctx, func(tx pgx.Tx) error {
+		var doc entities.Document
+		if err := scanDocument(tx.QueryRow(ctx, deleteQuery, id, cond.ExpectedVersion, cond.Actor), &doc); err != nil {
+			return err
+		}
+		return r.recordWrite(ctx, tx, entities.MutationDeleted, cond.Actor, &doc, nil)
+	})
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r.rejectedWrite(ctx, id, cond)
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "delete_document"),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return r.wrapError(err)
 	}
 
 	return nil
 }
 
+func (r *documentRepository) ListChanges(ctx context.Context, userID, userLogin string, since int64, limit int) ([]*entities.DocumentChange, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := r.pool.Query(ctx, listChangesQuery, since, userID, userLogin, limit)
+	if err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "list_document_changes"),
+			zap.String("user_id", userID),
+			zap.Int64("since", since),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("failed to list changes")
+	}
+	defer rows.Close()
+
+	var changes []*entities.DocumentChange
+	for rows.Next() {
+		change := &entities.DocumentChange{Document: &entities.DocumentSummary{}}
+		doc := change.Document
+		err := rows.Scan(
+			&change.Seq, &doc.ID, &change.Op, &doc.Name, &doc.OwnerID, &doc.MIME, &doc.IsFile, &doc.IsPublic,
+			&change.Access.Grant, &change.PrevAccess.Public, &change.PrevAccess.Grant, &doc.Version, &change.ChangedAt,
+		)
+		if err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "scan_document_change"),
+				zap.Error(err),
+			)
+			return nil, appErrors.NewInternalError("failed to scan change")
+		}
+
+		change.Access.OwnerID = doc.OwnerID
+		change.Access.Public = doc.IsPublic
+		change.PrevAccess.OwnerID = doc.OwnerID
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "iterate_rows"),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return changes, nil
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds.
+func (r *documentRepository) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// recordWrite queues the side effects of a write of doc in the outbox and
+// appends it to the change log, both in tx. prev holds the access before the
+// write if the write changed it. It must be the last statement of the write
+// transaction.
+//
+// Readers page the change log by seq, so a seq must never become visible
+// after a higher one. Rather than have readers hold back behind the oldest
+// transaction still in flight, appends take the global change log lock,
+// which is released on commit. That serialises only the append and the
+// commit: the document row, the outbox message and everything else are
+// written before the lock is taken.
+func (r *documentRepository) recordWrite(ctx context.Context, tx pgx.Tx, op, actor string, doc, prev *entities.Document) error {
+	if prev == nil {
+		prev = doc
+	}
+
+	err := enqueueOutbox(ctx, tx, entities.OutboxKindDocumentMutation, &entities.DocumentMutation{
+		Op:         op,
+		Actor:      actor,
+		Document:   entities.NewDocumentSummary(doc),
+		Access:     entities.NewDocumentAccess(doc),
+		PrevAccess: entities.NewDocumentAccess(prev),
+	})
+	if err != nil {
+		return err
+	}
+
+	changeOp := entities.DocumentChangeUpsert
+	if op == entities.MutationDeleted {
+		changeOp = entities.DocumentChangeDelete
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, changeLogLockKey); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, appendChangeQuery,
+		doc.ID, changeOp, doc.Name, doc.OwnerID, doc.MIME, doc.IsFile,
+		doc.IsPublic, doc.Grant, prev.IsPublic, prev.Grant, doc.Version,
+	)
+	return err
+}
+
+func (r *documentRepository) AcquireLock(ctx context.Context, id, holder string, ttl time.Duration) (*entities.Document, error) {
+	return r.updateLock(ctx, "acquire_document_lock", acquireLockQuery, id, holder, ttl.Seconds())
+}
+
+func (r *documentRepository) RefreshLock(ctx context.Context, id, holder string, ttl time.Duration) (*entities.Document, error) {
+	return r.updateLock(ctx, "refresh_document_lock", refreshLockQuery, id, holder, ttl.Seconds())
+}
+
+func (r *documentRepository) ReleaseLock(ctx context.Context, id, holder string, force bool) (*entities.Document, error) {
+	return r.updateLock(ctx, "release_document_lock", releaseLockQuery, id, holder, force)
+}
+
+func (r *documentRepository) updateLock(ctx context.Context, operation, query, id, holder string, arg any) (*entities.Document, error) {
+	var doc entities.Document
+	err := scanDocument(r.pool.QueryRow(ctx, query, id, holder, arg), &doc)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, r.lockRejection(ctx, id, holder)
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", operation),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return nil, r.wrapError(err)
+	}
+
+	return &doc, nil
+}
+
+// lockRejection explains why a lock operation matched no rows: the document
+// is gone, someone else holds the lock, or holder holds no lock at all.
+func (r *documentRepository) lockRejection(ctx context.Context, id, holder string) error {
+	var lockHolder *string
+	var acquiredAt, expiresAt *time.Time
+	if err := r.pool.QueryRow(ctx, lockStateQuery, id).Scan(&lockHolder, &acquiredAt, &expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return appErrors.NewNotFoundError("document not found")
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "get_document_lock"),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return r.wrapError(err)
+	}
+
+	lock := newDocumentLock(lockHolder, acquiredAt, expiresAt)
+	if lock != nil && lock.Holder != holder {
+		return lockedError(lock.Holder)
+	}
+
+	return appErrors.NewConflictError("document is not locked by you")
+}
+
+// rejectedWrite explains why a conditional write matched no rows: the
+// document is gone, someone else holds its lock, or its version moved on.
+func (r *documentRepository) rejectedWrite(ctx context.Context, id string, cond entities.WriteCondition) error {
+	var lockHolder *string
+	var lockLive *bool
+	if err := r.pool.QueryRow(ctx, writeStateQuery, id).Scan(&lockHolder, &lockLive); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return appErrors.NewNotFoundError("document not found")
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "get_document_write_state"),
+			zap.String("doc_id", id),
+			zap.Error(err),
+		)
+		return r.wrapError(err)
+	}
+
+	if lockHolder != nil && lockLive != nil && *lockLive && *lockHolder != cond.Actor {
+		return lockedError(*lockHolder)
+	}
+
+	return appErrors.NewPreconditionFailedError("document version does not match")
+}
+
+func lockedError(holder string) error {
+	return appErrors.NewLockedError(fmt.Sprintf("document is locked by %s", holder))
+}
+
 func (r *documentRepository) buildFilterQuery(filter *entities.DocumentFilter) (string, []any) {
-	var conditions []string
 	var args []any
 	argIndex := 1
 
-	if filter.OwnerID != "" {
-		conditions = append(conditions, fmt.Sprintf("owner_id = $%d", argIndex))
-		args = append(args, filter.OwnerID)
-		argIndex++
+	columns := documentColumns
+	if len(filter.Fields) > 0 {
+		columns, args, argIndex = projectedColumns(filter.Fields, argIndex)
 	}
 
-	if filter.Key != "" && filter.Value != "" {
-		condition, newArgs, newIndex := r.buildKeyValueFilter(filter.Key, filter.Value, argIndex)
-		if condition != "" {
-			conditions = append(conditions, condition)
-			args = append(args, newArgs...)
-			argIndex = newIndex
-		}
-	}
+	conditions, rank, args, argIndex := r.buildFilterConditions(filter, args, argIndex)
 
-	query := baseSelectQuery
+	query := "SELECT " + columns + " FROM documents"
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	query += " ORDER BY name ASC, created_at DESC"
+	var orderBy []string
+	if rank != "" {
+		orderBy = append(orderBy, rank+" DESC")
+	}
+	orderBy = append(orderBy, "name ASC", "created_at DESC")
+	query += " ORDER BY " + strings.Join(orderBy, ", ")
 
 	if filter.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT $%d", argIndex)
@@ -155,33 +685,120 @@ func (r *documentRepository) buildFilterQuery(filter *entities.DocumentFilter) (
 	return query, args
 }
 
-func (r *documentRepository) buildKeyValueFilter(key, value string, startIndex int) (string, []any, int) {
+// buildFilterConditions returns the owner and key/value conditions of a list
+// filter, appending their arguments to args. rank is set for ranked search
+// modes and orders best matches first.
+func (r *documentRepository) buildFilterConditions(filter *entities.DocumentFilter, args []any, argIndex int) ([]string, string, []any, int) {
+	var conditions []string
+	var rank string
+
+	if filter.OwnerID != "" {
+		conditions = append(conditions, fmt.Sprintf("owner_id = $%d", argIndex))
+		args = append(args, filter.OwnerID)
+		argIndex++
+	}
+
+	if filter.Key != "" && filter.Value != "" {
+		condition, keyRank, newArgs, newIndex := r.buildKeyValueFilter(filter.Key, filter.Value, filter.Mode, argIndex)
+		if condition != "" {
+			conditions = append(conditions, condition)
+			args = append(args, newArgs...)
+			argIndex = newIndex
+		}
+		rank = keyRank
+	}
+
+	return conditions, rank, args, argIndex
+}
+
+// buildKeyValueFilter returns the WHERE condition for a key/value pair and, for
+// ranked search modes, an expression to order results by (highest first).
+func (r *documentRepository) buildKeyValueFilter(key, value, mode string, startIndex int) (string, string, []any, int) {
 	switch key {
 	case "name":
-		return fmt.Sprintf("name ILIKE $%d", startIndex), []any{"%" + value + "%"}, startIndex + 1
+		if mode == entities.SearchModeSimilar {
+			return fmt.Sprintf("name %% $%d", startIndex),
+				fmt.Sprintf("similarity(name, $%d)", startIndex),
+				[]any{value}, startIndex + 1
+		}
+		return fmt.Sprintf(`name ILIKE $%d ESCAPE '\'`, startIndex), "", []any{"%" + escapeLike(value) + "%"}, startIndex + 1
 	case "mime":
-		return fmt.Sprintf("mime = $%d", startIndex), []any{value}, startIndex + 1
+		return fmt.Sprintf("mime = $%d", startIndex), "", []any{value}, startIndex + 1
 	case "public":
 		if publicBool, err := strconv.ParseBool(value); err == nil {
-			return fmt.Sprintf("is_public = $%d", startIndex), []any{publicBool}, startIndex + 1
+			return fmt.Sprintf("is_public = $%d", startIndex), "", []any{publicBool}, startIndex + 1
 		}
-		return "", nil, startIndex
+		return "", "", nil, startIndex
 	default:
-		return fmt.Sprintf("json_data->>$%d = $%d", startIndex, startIndex+1), []any{key, value}, startIndex + 2
+		if mode == entities.SearchModeSimilar {
+			return fmt.Sprintf("json_data->>$%d %% $%d", startIndex, startIndex+1),
+				fmt.Sprintf("similarity(json_data->>$%d, $%d)", startIndex, startIndex+1),
+				[]any{key, value}, startIndex + 2
+		}
+		return fmt.Sprintf("json_data->>$%d = $%d", startIndex, startIndex+1), "", []any{key, value}, startIndex + 2
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards in user input, so they match
+// themselves; patterns using it declare ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// withSimilarityThreshold runs fn inside a transaction with the pg_trgm
+// similarity threshold set locally, so the % operator (and the trigram index
+// behind it) honours the requested threshold. A nil threshold runs fn directly
+// on the pool with the server default.
+func (r *documentRepository) withSimilarityThreshold(ctx context.Context, threshold *float64, fn func(q querier) error) error {
+	if threshold == nil {
+		return fn(r.pool)
+	}
+
+	log := logger.FromContext(ctx)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "begin_search_tx"),
+			zap.Error(err),
+		)
+		return r.wrapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, setSimilarityThresholdQuery, strconv.FormatFloat(*threshold, 'f', -1, 64)); err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "set_similarity_threshold"),
+			zap.Float64("threshold", *threshold),
+			zap.Error(err),
+		)
+		return r.wrapError(err)
+	}
+
+	if err := fn(tx); err != nil {
+		return err
 	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *documentRepository) scanDocuments(rows pgx.Rows) ([]*entities.Document, error) {
+func (r *documentRepository) scanDocuments(ctx context.Context, rows pgx.Rows, projection *entities.JSONProjection) ([]*entities.Document, error) {
 	var docs []*entities.Document
 
+	log := logger.FromContext(ctx)
+
 	for rows.Next() {
 		doc := &entities.Document{}
-		err := rows.Scan(
-			&doc.ID, &doc.Name, &doc.OwnerID, &doc.MIME, &doc.IsFile, &doc.IsPublic,
-			&doc.FilePath, &doc.JSONData, &doc.Grant, &doc.CreatedAt, &doc.UpdatedAt,
-		)
+		var err error
+		if projection != nil {
+			err = scanProjectedDocument(rows, doc, projection)
+		} else {
+			err = scanDocument(rows, doc)
+		}
 		if err != nil {
-			r.logger.Error("Database operation failed",
+			log.Error("Database operation failed",
 				zap.String("operation", "scan_document_row"),
 				zap.Error(err),
 			)
@@ -191,7 +808,7 @@ func (r *documentRepository) scanDocuments(rows pgx.Rows) ([]*entities.Document,
 	}
 
 	if err := rows.Err(); err != nil {
-		r.logger.Error("Database operation failed",
+		log.Error("Database operation failed",
 			zap.String("operation", "iterate_rows"),
 			zap.Error(err),
 		)
@@ -201,6 +818,87 @@ func (r *documentRepository) scanDocuments(rows pgx.Rows) ([]*entities.Document,
 	return docs, nil
 }
 
+// scanDocument reads a row selected with documentColumns.
+func scanDocument(row pgx.Row, doc *entities.Document) error {
+	return scanDocumentInto(row, doc, &doc.JSONData)
+}
+
+// scanProjectedDocument reads a row selected with projectedColumns and stores
+// the projection result as the document's JSON body.
+func scanProjectedDocument(row pgx.Row, doc *entities.Document, projection *entities.JSONProjection) error {
+	var values []*string
+	if err := scanDocumentInto(row, doc, &values); err != nil {
+		return err
+	}
+
+	raws := make([]json.RawMessage, len(values))
+	found := false
+	for i, value := range values {
+		if value != nil {
+			raws[i] = json.RawMessage(*value)
+			found = true
+		}
+	}
+
+	doc.JSONData = nil
+	if !found {
+		return nil
+	}
+
+	if projection.Pointer != nil {
+		doc.JSONData = &raws[0]
+		return nil
+	}
+
+	data, err := jsonpatch.Assemble(projection.Fields, raws)
+	if err != nil {
+		return err
+	}
+	projected := json.RawMessage(data)
+	doc.JSONData = &projected
+
+	return nil
+}
+
+func scanDocumentInto(row pgx.Row, doc *entities.Document, jsonData any) error {
+	var lockHolder *string
+	var lockAcquiredAt, lockExpiresAt *time.Time
+	err := row.Scan(
+		&doc.ID, &doc.Name, &doc.OwnerID, &doc.MIME, &doc.IsFile, &doc.IsPublic,
+		&doc.FilePath, jsonData, &doc.Grant, &doc.SchemaID, &doc.Version,
+		&lockHolder, &lockAcquiredAt, &lockExpiresAt, &doc.CreatedAt, &doc.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	doc.Lock = newDocumentLock(lockHolder, lockAcquiredAt, lockExpiresAt)
+	return nil
+}
+
+// newDocumentLock builds the lock from the nullable liveLockColumns.
+func newDocumentLock(holder *string, acquiredAt, expiresAt *time.Time) *entities.DocumentLock {
+	if holder == nil || acquiredAt == nil || expiresAt == nil {
+		return nil
+	}
+	return &entities.DocumentLock{Holder: *holder, AcquiredAt: *acquiredAt, ExpiresAt: *expiresAt}
+}
+
+// projectedColumns returns documentColumns with json_data replaced by an
+// array of the requested paths, extracted in Postgres with #> so the full JSON
+// body is never transferred.
+func projectedColumns(paths []jsonpatch.Pointer, startIndex int) (string, []any, int) {
+	exprs := make([]string, len(paths))
+	args := make([]any, len(paths))
+	for i, path := range paths {
+		exprs[i] = fmt.Sprintf("json_data #> $%d::text[]", startIndex+i)
+		args[i] = []string(path)
+	}
+
+	columns := strings.Replace(documentColumns, "json_data", "ARRAY["+strings.Join(exprs, ", ")+"]::jsonb[]", 1)
+	return columns, args, startIndex + len(paths)
+}
+
 func (r *documentRepository) wrapError(err error) error {
 	if err == nil {
 		return nil
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	appErrors "document-server/pkg/errors"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	outboxColumns = `id, kind, payload, attempts, next_attempt_at, last_error, created_at`
+	enqueueQuery  = `INSERT INTO outbox (kind, payload) VALUES ($1, $2)`
+	claimQuery    = `UPDATE outbox SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2::double precision)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE next_attempt_at <= NOW()
+			ORDER BY id ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+)
+
+type outboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool) repositories.OutboxRepository {
+	return &outboxRepository{pool: pool}
+}
+
+// enqueueOutbox queues a message in tx, so that it exists if and only if the
+// write it belongs to commits.
+func enqueueOutbox(ctx context.Context, tx pgx.Tx, kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, enqueueQuery, kind, data)
+	return err
+}
+
+func (r *outboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*entities.OutboxMessage, error) {
+	rows, err := r.pool.Query(ctx, claimQuery, limit, lease.Seconds())
+	if err != nil {
+		return nil, appErrors.NewInternalError("outbox claim failed")
+	}
+	defer rows.Close()
+
+	var messages []*entities.OutboxMessage
+	for rows.Next() {
+		var message entities.OutboxMessage
+		err := rows.Scan(
+			&message.ID, &message.Kind, &message.Payload, &message.Attempts,
+			&message.NextAttemptAt, &message.LastError, &message.CreatedAt,
+		)
+		if err != nil {
+			return nil, appErrors.NewInternalError("failed to scan outbox message")
+		}
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return messages, nil
+}
+
+func (r *outboxRepository) Complete(ctx context.Context, id int64) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM outbox WHERE id = $1`, id); err != nil {
+		return appErrors.NewInternalError("outbox delete failed")
+	}
+	return nil
+}
+
+func (r *outboxRepository) Fail(ctx context.Context, id int64, retryIn time.Duration, lastError string) error {
+	query := `UPDATE outbox SET next_attempt_at = NOW() + make_interval(secs => $2::double precision), last_error = $3 WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, retryIn.Seconds(), lastError); err != nil {
+		return appErrors.NewInternalError("outbox update failed")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	appErrors "document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const schemaColumns = `id, name, owner_id, schema, patterns, created_at, updated_at`
+
+type schemaRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSchemaRepository(pool *pgxpool.Pool) repositories.SchemaRepository {
+	return &schemaRepository{pool: pool}
+}
+
+func (r *schemaRepository) Upsert(ctx context.Context, schema *entities.JSONSchema) error {
+	query := `INSERT INTO json_schemas (name, owner_id, schema, patterns) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (owner_id, name) DO UPDATE SET schema = EXCLUDED.schema, patterns = EXCLUDED.patterns, updated_at = NOW()
+		RETURNING id, created_at, updated_at`
+
+	err := r.pool.QueryRow(ctx, query, schema.Name, schema.OwnerID, schema.Schema, schema.Patterns).
+		Scan(&schema.ID, &schema.CreatedAt, &schema.UpdatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "upsert_schema"),
+			zap.String("owner_id", schema.OwnerID),
+			zap.String("name", schema.Name),
+			zap.Error(err),
+		)
+		return appErrors.NewInternalError("schema upsert failed")
+	}
+	return nil
+}
+
+func (r *schemaRepository) GetByID(ctx context.Context, id string) (*entities.JSONSchema, error) {
+	query := `SELECT ` + schemaColumns + ` FROM json_schemas WHERE id = $1`
+	return r.getOne(ctx, "get_schema_by_id", query, id)
+}
+
+func (r *schemaRepository) GetByName(ctx context.Context, ownerID, name string) (*entities.JSONSchema, error) {
+	query := `SELECT ` + schemaColumns + ` FROM json_schemas WHERE owner_id = $1 AND name = $2`
+	return r.getOne(ctx, "get_schema_by_name", query, ownerID, name)
+}
+
+func (r *schemaRepository) ListByOwner(ctx context.Context, ownerID string) ([]*entities.JSONSchema, error) {
+	query := `SELECT ` + schemaColumns + ` FROM json_schemas WHERE owner_id = $1 ORDER BY name ASC`
+
+	log := logger.FromContext(ctx)
+
+	rows, err := r.pool.Query(ctx, query, ownerID)
+	if err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "list_schemas"),
+			zap.String("owner_id", ownerID),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("schema query failed")
+	}
+	defer rows.Close()
+
+	var schemas []*entities.JSONSchema
+	for rows.Next() {
+		var schema entities.JSONSchema
+		if err := scanSchema(rows, &schema); err != nil {
+			log.Error("Database operation failed",
+				zap.String("operation", "scan_schema"),
+				zap.Error(err),
+			)
+			return nil, appErrors.NewInternalError("failed to scan schema")
+		}
+		schemas = append(schemas, &schema)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Error("Database operation failed",
+			zap.String("operation", "iterate_rows"),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return schemas, nil
+}
+
+func (r *schemaRepository) Delete(ctx context.Context, ownerID, name string) error {
+	query := `DELETE FROM json_schemas WHERE owner_id = $1 AND name = $2`
+
+	result, err := r.pool.Exec(ctx, query, ownerID, name)
+	if err != nil {
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", "delete_schema"),
+			zap.String("owner_id", ownerID),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+		return appErrors.NewInternalError("schema delete failed")
+	}
+	if result.RowsAffected() == 0 {
+		return appErrors.NewNotFoundError("schema not found")
+	}
+	return nil
+}
+
+func (r *schemaRepository) getOne(ctx context.Context, operation, query string, args ...any) (*entities.JSONSchema, error) {
+	var schema entities.JSONSchema
+	if err := scanSchema(r.pool.QueryRow(ctx, query, args...), &schema); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("schema not found")
+		}
+		logger.FromContext(ctx).Error("Database operation failed",
+			zap.String("operation", operation),
+			zap.Error(err),
+		)
+		return nil, appErrors.NewInternalError("schema query failed")
+	}
+	return &schema, nil
+}
+
+func scanSchema(row pgx.Row, schema *entities.JSONSchema) error {
+	return row.Scan(
+		&schema.ID, &schema.Name, &schema.OwnerID, &schema.Schema,
+		&schema.Patterns, &schema.CreatedAt, &schema.UpdatedAt,
+	)
+}
@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	appErrors "document-server/pkg/errors"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	webhookColumns  = `id, owner_id, url, secret, events, active, created_at, updated_at`
+	deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+		last_status_code, last_error, delivered_at, created_at, updated_at`
+)
+
+type webhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool) repositories.WebhookRepository {
+	return &webhookRepository{pool: pool}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *entities.Webhook) error {
+	query := `INSERT INTO webhooks (owner_id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+
+	err := r.pool.QueryRow(ctx, query, webhook.OwnerID, webhook.URL, webhook.Secret, webhook.Events, webhook.Active).
+		Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return appErrors.NewInternalError("webhook insert failed")
+	}
+	return nil
+}
+
+func (r *webhookRepository) List(ctx context.Context, ownerID *string) ([]*entities.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE owner_id IS NOT DISTINCT FROM $1 ORDER BY created_at ASC`
+
+	rows, err := r.pool.Query(ctx, query, ownerID)
+	if err != nil {
+		return nil, appErrors.NewInternalError("webhook query failed")
+	}
+	return collectWebhooks(rows)
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id string) (*entities.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	var webhook entities.Webhook
+	if err := scanWebhook(r.pool.QueryRow(ctx, query, id), &webhook); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("webhook not found")
+		}
+		return nil, appErrors.NewInternalError("webhook query failed")
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return appErrors.NewInternalError("webhook delete failed")
+	}
+	if result.RowsAffected() == 0 {
+		return appErrors.NewNotFoundError("webhook not found")
+	}
+	return nil
+}
+
+func (r *webhookRepository) Subscribers(ctx context.Context, eventType, docOwnerID string) ([]*entities.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks
+		WHERE active AND (owner_id IS NULL OR owner_id = $1) AND (cardinality(events) = 0 OR $2 = ANY(events))`
+
+	rows, err := r.pool.Query(ctx, query, docOwnerID, eventType)
+	if err != nil {
+		return nil, appErrors.NewInternalError("webhook query failed")
+	}
+	return collectWebhooks(rows)
+}
+
+func (r *webhookRepository) EnqueueDeliveries(ctx context.Context, deliveries []*entities.WebhookDelivery) error {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING`
+
+	batch := &pgx.Batch{}
+	for _, delivery := range deliveries {
+		batch.Queue(query, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Payload)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return appErrors.NewInternalError("failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return appErrors.NewInternalError("webhook delivery insert failed")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.NewInternalError("failed to commit webhook deliveries")
+	}
+	return nil
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*entities.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2::double precision), updated_at = NOW()
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at,
+			w.id, w.owner_id, w.url, w.secret, w.events, w.active, w.created_at, w.updated_at`
+
+	rows, err := r.pool.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, appErrors.NewInternalError("webhook delivery claim failed")
+	}
+	defer rows.Close()
+
+	var deliveries []*entities.WebhookDelivery
+	for rows.Next() {
+		delivery := &entities.WebhookDelivery{Webhook: &entities.Webhook{}}
+		webhook := delivery.Webhook
+		err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+			&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.DeliveredAt, &delivery.CreatedAt, &delivery.UpdatedAt,
+			&webhook.ID, &webhook.OwnerID, &webhook.URL, &webhook.Secret, &webhook.Events,
+			&webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt,
+		)
+		if err != nil {
+			return nil, appErrors.NewInternalError("failed to scan webhook delivery")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) MarkDelivered(ctx context.Context, id string, statusCode int) error {
+	query := `UPDATE webhook_deliveries SET status = 'delivered', last_status_code = $2, last_error = NULL,
+		delivered_at = NOW(), updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, statusCode); err != nil {
+		return appErrors.NewInternalError("webhook delivery update failed")
+	}
+	return nil
+}
+
+func (r *webhookRepository) MarkFailed(ctx context.Context, id string, status string, retryIn time.Duration, statusCode *int, lastError string) error {
+	query := `UPDATE webhook_deliveries SET status = $2, next_attempt_at = NOW() + make_interval(secs => $3::double precision),
+		last_status_code = $4, last_error = $5, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, status, retryIn.Seconds(), statusCode, lastError); err != nil {
+		return appErrors.NewInternalError("webhook delivery update failed")
+	}
+	return nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookID string, status string, limit, offset int) ([]*entities.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2::text = '' OR status = $2)
+		ORDER BY created_at DESC LIMIT $3 OFFSET $4`
+
+	rows, err := r.pool.Query(ctx, query, webhookID, status, limit, offset)
+	if err != nil {
+		return nil, appErrors.NewInternalError("webhook delivery query failed")
+	}
+	defer rows.Close()
+
+	var deliveries []*entities.WebhookDelivery
+	for rows.Next() {
+		var delivery entities.WebhookDelivery
+		if err := scanDelivery(rows, &delivery); err != nil {
+			return nil, appErrors.NewInternalError("failed to scan webhook delivery")
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) ReplayDelivery(ctx context.Context, webhookID, deliveryID string) (*entities.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = NOW(),
+		last_status_code = NULL, last_error = NULL, delivered_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING ` + deliveryColumns
+
+	var delivery entities.WebhookDelivery
+	if err := scanDelivery(r.pool.QueryRow(ctx, query, deliveryID, webhookID), &delivery); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appErrors.NewNotFoundError("webhook delivery not found")
+		}
+		return nil, appErrors.NewInternalError("webhook delivery update failed")
+	}
+	return &delivery, nil
+}
+
+func collectWebhooks(rows pgx.Rows) ([]*entities.Webhook, error) {
+	defer rows.Close()
+
+	var webhooks []*entities.Webhook
+	for rows.Next() {
+		var webhook entities.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, appErrors.NewInternalError("failed to scan webhook")
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.NewInternalError("rows iteration error")
+	}
+
+	return webhooks, nil
+}
+
+func scanWebhook(row pgx.Row, webhook *entities.Webhook) error {
+	return row.Scan(
+		&webhook.ID, &webhook.OwnerID, &webhook.URL, &webhook.Secret,
+		&webhook.Events, &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt,
+	)
+}
+
+func scanDelivery(row pgx.Row, delivery *entities.WebhookDelivery) error {
+	return row.Scan(
+		&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+		&delivery.LastStatusCode, &delivery.LastError, &delivery.DeliveredAt, &delivery.CreatedAt, &delivery.UpdatedAt,
+	)
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNoSchema is returned by SchemaVersion for a database no migration has
+// run on.
+var ErrNoSchema = errors.New("no migrations applied")
+
+// SchemaVersion returns the version golang-migrate recorded and whether the
+// last migration failed halfway.
+func (p *PostgresDB) SchemaVersion(ctx context.Context) (uint64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := p.pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, false, ErrNoSchema
+	case errors.As(err, &pgErr) && pgErr.Code == "42P01": // undefined_table
+		return 0, false, ErrNoSchema
+	case err != nil:
+		return 0, false, err
+	}
+	return uint64(version), dirty, nil
+}
+
+func (p *PostgresDB) ServerVersion(ctx context.Context) (string, error) {
+	var version string
+	err := p.pool.QueryRow(ctx, `SHOW server_version`).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/services"
+	"document-server/internal/infrastructure/cache"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentCache returns c counting the result of every call.
+func (m *Metrics) InstrumentCache(c services.CacheService) services.CacheService {
+	return &instrumentedCache{next: c, operations: m.cacheOperations}
+}
+
+// WatchBreaker exposes the state of the Redis circuit breaker: the gauge of
+// the current state is 1, the others 0.
+func (m *Metrics) WatchBreaker(b *cache.Breaker) {
+	for _, state := range []cache.BreakerState{cache.BreakerClosed, cache.BreakerOpen, cache.BreakerHalfOpen, cache.BreakerRecovering} {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "cache",
+			Name:        "breaker_state",
+			Help:        "State of the Redis circuit breaker.",
+			ConstLabels: prometheus.Labels{"state": string(state)},
+		}, func() float64 {
+			if b.State() == state {
+				return 1
+			}
+			return 0
+		}))
+	}
+}
+
+// WatchTieredCache exposes the hits and misses of both tiers of t.
+func (m *Metrics) WatchTieredCache(t *services.TieredCacheService) {
+	counters := map[[2]string]func(services.CacheStats) uint64{
+		{"local", "hit"}:   func(s services.CacheStats) uint64 { return s.Local.Hits },
+		{"local", "miss"}:  func(s services.CacheStats) uint64 { return s.Local.Misses },
+		{"remote", "hit"}:  func(s services.CacheStats) uint64 { return s.Remote.Hits },
+		{"remote", "miss"}: func(s services.CacheStats) uint64 { return s.Remote.Misses },
+	}
+	for labels, read := range counters {
+		m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "cache",
+			Name:        "tier_lookups_total",
+			Help:        "Document and list lookups, by cache tier and result.",
+			ConstLabels: prometheus.Labels{"tier": labels[0], "result": labels[1]},
+		}, func() float64 {
+			return float64(read(t.Stats()))
+		}))
+	}
+}
+
+type instrumentedCache struct {
+	next       services.CacheService
+	operations *prometheus.CounterVec
+}
+
+// lookup counts the result of a read: a hit, a miss or a failure.
+func (c *instrumentedCache) lookup(operation string, err error) {
+	if err == nil {
+		c.operations.WithLabelValues(operation, "hit").Inc()
+		return
+	}
+	c.write(operation, err)
+}
+
+// write counts the result of any other call.
+func (c *instrumentedCache) write(operation string, err error) {
+	result := "ok"
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrCacheMiss):
+		result = "miss"
+	case errors.Is(err, services.ErrCacheUnavailable):
+		result = "unavailable"
+	default:
+		result = "error"
+	}
+	c.operations.WithLabelValues(operation, result).Inc()
+}
+
+func (c *instrumentedCache) GetDocument(ctx context.Context, docID string) (*entities.Document, bool, error) {
+	doc, fresh, err := c.next.GetDocument(ctx, docID)
+	c.lookup("get_document", err)
+	return doc, fresh, err
+}
+
+func (c *instrumentedCache) SetDocument(ctx context.Context, doc *entities.Document) error {
+	err := c.next.SetDocument(ctx, doc)
+	c.write("set_document", err)
+	return err
+}
+
+func (c *instrumentedCache) LockDocumentLoad(ctx context.Context, docID string) (bool, error) {
+	locked, err := c.next.LockDocumentLoad(ctx, docID)
+	c.write("lock_document_load", err)
+	return locked, err
+}
+
+func (c *instrumentedCache) UnlockDocumentLoad(ctx context.Context, docID string) error {
+	err := c.next.UnlockDocumentLoad(ctx, docID)
+	c.write("unlock_document_load", err)
+	return err
+}
+
+func (c *instrumentedCache) GetDocumentList(ctx context.Context, key string) ([]*entities.Document, error) {
+	docs, err := c.next.GetDocumentList(ctx, key)
+	c.lookup("get_document_list", err)
+	return docs, err
+}
+
+func (c *instrumentedCache) SetDocumentList(ctx context.Context, ownerID, key string, docs []*entities.Document) error {
+	err := c.next.SetDocumentList(ctx, ownerID, key, docs)
+	c.write("set_document_list", err)
+	return err
+}
+
+func (c *instrumentedCache) InvalidateDocument(ctx context.Context, docID string) error {
+	err := c.next.InvalidateDocument(ctx, docID)
+	c.write("invalidate_document", err)
+	return err
+}
+
+func (c *instrumentedCache) InvalidatePrefix(ctx context.Context, prefix string) error {
+	err := c.next.InvalidatePrefix(ctx, prefix)
+	c.write("invalidate_prefix", err)
+	return err
+}
+
+func (c *instrumentedCache) ListCacheKey(ctx context.Context, filter *entities.DocumentFilter) (string, error) {
+	key, err := c.next.ListCacheKey(ctx, filter)
+	c.write("list_cache_key", err)
+	return key, err
+}
+
+func (c *instrumentedCache) InvalidateOwnerLists(ctx context.Context, ownerID string) error {
+	err := c.next.InvalidateOwnerLists(ctx, ownerID)
+	c.write("invalidate_owner_lists", err)
+	return err
+}
+
+func (c *instrumentedCache) GetSession(ctx context.Context, token string) (*entities.Session, error) {
+	session, err := c.next.GetSession(ctx, token)
+	c.lookup("get_session", err)
+	return session, err
+}
+
+func (c *instrumentedCache) SetSession(ctx context.Context, session *entities.Session) error {
+	err := c.next.SetSession(ctx, session)
+	c.write("set_session", err)
+	return err
+}
+
+func (c *instrumentedCache) InvalidateSession(ctx context.Context, token string) error {
+	err := c.next.InvalidateSession(ctx, token)
+	c.write("invalidate_session", err)
+	return err
+}
+
+func (c *instrumentedCache) GetUserByID(ctx context.Context, userID string) (*entities.User, error) {
+	user, err := c.next.GetUserByID(ctx, userID)
+	c.lookup("get_user", err)
+	return user, err
+}
+
+func (c *instrumentedCache) GetUserByLogin(ctx context.Context, login string) (*entities.User, error) {
+	user, err := c.next.GetUserByLogin(ctx, login)
+	c.lookup("get_user", err)
+	return user, err
+}
+
+func (c *instrumentedCache) SetUser(ctx context.Context, user *entities.User) error {
+	err := c.next.SetUser(ctx, user)
+	c.write("set_user", err)
+	return err
+}
+
+var _ services.CacheService = (*instrumentedCache)(nil)
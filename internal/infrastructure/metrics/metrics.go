@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "docserver"
+
+// Metrics holds the server's Prometheus metrics in a registry of its own, so
+// only what is registered here is exposed.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	inFlight        prometheus.Gauge
+
+	uploadedBytes   prometheus.Counter
+	downloadedBytes prometheus.Counter
+
+	cacheOperations *prometheus.CounterVec
+
+	documents   *prometheus.GaugeVec
+	storedBytes prometheus.Gauge
+	queueDepth  *prometheus.GaugeVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests handled, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "HTTP requests being handled.",
+		}),
+		uploadedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "uploaded_bytes_total",
+			Help:      "Bytes of files uploaded.",
+		}),
+		downloadedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "downloaded_bytes_total",
+			Help:      "Bytes of files downloaded.",
+		}),
+		cacheOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "operations_total",
+			Help:      "Cache operations, by operation and result: hit, miss, ok, unavailable or error.",
+		}, []string{"operation", "result"}),
+		documents: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "documents",
+			Help:      "Stored documents, by kind: file or json.",
+		}, []string{"kind"}),
+		storedBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "stored_bytes",
+			Help:      "Bytes of files in the storage directory.",
+		}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_depth",
+			Help:      "Messages waiting in the background queues: outbox and webhook_deliveries.",
+		}, []string{"queue"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.inFlight,
+		m.uploadedBytes,
+		m.downloadedBytes,
+		m.cacheOperations,
+		m.documents,
+		m.storedBytes,
+		m.queueDepth,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records every request under its route pattern rather than its
+// path, so document IDs do not each get a series. Requests matching no route
+// are recorded as "unmatched".
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		start := time.Now()
+		// Read before HEAD requests are turned into GET ones.
+		method := c.Request.Method
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := prometheus.Labels{
+			"method": method,
+			"route":  route,
+			"status": strconv.Itoa(c.Writer.Status()),
+		}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *Metrics) FileUploaded(bytes int64) {
+	m.uploadedBytes.Add(float64(bytes))
+}
+
+func (m *Metrics) FileDownloaded(bytes int64) {
+	m.downloadedBytes.Add(float64(bytes))
+}
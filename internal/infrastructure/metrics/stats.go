@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"document-server/pkg/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	documentCountsQuery = `SELECT COUNT(*) FILTER (WHERE is_file), COUNT(*) FILTER (WHERE NOT is_file) FROM documents`
+	outboxDepthQuery    = `SELECT COUNT(*) FROM outbox`
+	deliveryDepthQuery  = `SELECT COUNT(*) FROM webhook_deliveries WHERE status = 'pending'`
+
+	statsTimeout = 30 * time.Second
+)
+
+// RunStats refreshes the document counts, the stored bytes under
+// storagePath and the queue depths every interval until ctx is done. They
+// are too costly to compute at every scrape.
+func (m *Metrics) RunStats(ctx context.Context, pool *pgxpool.Pool, storagePath string, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.refreshStats(ctx, pool, storagePath)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Metrics) refreshStats(ctx context.Context, pool *pgxpool.Pool, storagePath string) {
+	ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+	defer cancel()
+
+	var files, jsonDocs int64
+	if err := pool.QueryRow(ctx, documentCountsQuery).Scan(&files, &jsonDocs); err != nil {
+		logger.Warn("Failed to count documents for metrics", zap.Error(err))
+	} else {
+		m.documents.WithLabelValues("file").Set(float64(files))
+		m.documents.WithLabelValues("json").Set(float64(jsonDocs))
+	}
+
+	for queue, query := range map[string]string{
+		"outbox":             outboxDepthQuery,
+		"webhook_deliveries": deliveryDepthQuery,
+	} {
+		var depth int64
+		if err := pool.QueryRow(ctx, query).Scan(&depth); err != nil {
+			logger.Warn("Failed to measure queue depth for metrics",
+				zap.String("queue", queue),
+				zap.Error(err),
+			)
+			continue
+		}
+		m.queueDepth.WithLabelValues(queue).Set(float64(depth))
+	}
+
+	size, err := directorySize(storagePath)
+	if err != nil {
+		logger.Warn("Failed to measure storage directory for metrics",
+			zap.String("path", storagePath),
+			zap.Error(err),
+		)
+		return
+	}
+	m.storedBytes.Set(float64(size))
+}
+
+// directorySize sums the sizes of the regular files under path. A missing
+// directory holds nothing yet.
+func directorySize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Deleted since the directory was read.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
@@ -0,0 +1,20 @@
+package dto
+
+import "document-server/internal/domain/entities"
+
+type AuditListRequest struct {
+	Token      string `form:"token" binding:"required"`
+	Actor      string `form:"actor,omitempty"`
+	Action     string `form:"action,omitempty"`
+	TargetType string `form:"target_type,omitempty"`
+	TargetID   string `form:"target,omitempty"`
+	Outcome    string `form:"outcome,omitempty"`
+	From       string `form:"from,omitempty"`
+	To         string `form:"to,omitempty"`
+	Limit      int    `form:"limit,omitempty"`
+	Offset     int    `form:"offset,omitempty"`
+}
+
+type AuditListResponse struct {
+	Events []*entities.AuditEvent `json:"events"`
+}
@@ -13,6 +13,19 @@ type DocumentMeta struct {
 	Token  string   `json:"token" binding:"required"`
 	MIME   string   `json:"mime"`
 	Grant  []string `json:"grant"`
+	Schema string   `json:"schema,omitempty"`
+}
+
+type DocumentUpdateMeta struct {
+	Name *string `json:"name,omitempty"`
+	MIME *string `json:"mime,omitempty"`
+	// Schema attaches the named schema; an empty name detaches it.
+	Schema *string `json:"schema,omitempty"`
+}
+
+type DocumentAccessRequest struct {
+	Public *bool    `json:"public,omitempty"`
+	Grant  []string `json:"grant"`
 }
 
 type DocumentCreateRequest struct {
@@ -27,18 +40,62 @@ type DocumentCreateResponse struct {
 }
 
 type DocumentListRequest struct {
-	Token string `form:"token" binding:"required"`
-	Login string `form:"login,omitempty"`
-	Key   string `form:"key,omitempty"`
-	Value string `form:"value,omitempty"`
-	Limit int    `form:"limit,omitempty"`
+	Token     string   `form:"token" binding:"required"`
+	Login     string   `form:"login,omitempty"`
+	Key       string   `form:"key,omitempty"`
+	Value     string   `form:"value,omitempty"`
+	Mode      string   `form:"mode,omitempty"`
+	Threshold *float64 `form:"threshold,omitempty"`
+	Fields    string   `form:"fields,omitempty"`
+	Limit     int      `form:"limit,omitempty"`
 }
 
 type DocumentListResponse struct {
 	Docs []*entities.Document `json:"docs"`
 }
 
+type DocumentAggregateRequest struct {
+	DocumentListRequest
+	GroupBy string `form:"group_by" binding:"required"`
+	Metric  string `form:"metric,omitempty"`
+	Field   string `form:"field,omitempty"`
+}
+
+type DocumentAggregateResponse struct {
+	GroupBy string                      `json:"group_by"`
+	Metric  string                      `json:"metric"`
+	Field   string                      `json:"field,omitempty"`
+	Buckets []*entities.AggregateBucket `json:"buckets"`
+}
+
+type DocumentSuggestRequest struct {
+	Token string `form:"token" binding:"required"`
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit,omitempty"`
+}
+
+type DocumentSuggestResponse struct {
+	Names []string `json:"names"`
+}
+
+type DocumentLockRequest struct {
+	Token string `form:"token" binding:"required"`
+	TTL   string `form:"ttl,omitempty"`
+	Force bool   `form:"force,omitempty"`
+}
+
+type DocumentLockResponse struct {
+	ID   string                 `json:"id"`
+	Lock *entities.DocumentLock `json:"lock"`
+}
+
 type DocumentDeleteResponse struct {
 	ID      string `json:"id"`
 	Success bool   `json:"success"`
 }
+
+type DocumentChangesRequest struct {
+	Token string `form:"token" binding:"required"`
+	Since string `form:"since,omitempty"`
+	Limit int    `form:"limit,omitempty"`
+}
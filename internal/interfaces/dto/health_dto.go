@@ -0,0 +1,9 @@
+package dto
+
+type StatusRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+type MetricsRequest struct {
+	Token string `form:"token" binding:"required"`
+}
@@ -7,6 +7,7 @@ type APIResponse struct {
 }
 
 type ErrorResponse struct {
-	Code int    `json:"code"`
-	Text string `json:"text"`
+	Code    int    `json:"code"`
+	Text    string `json:"text"`
+	Details any    `json:"details,omitempty"`
 }
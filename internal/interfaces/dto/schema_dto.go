@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"document-server/internal/domain/entities"
+	"encoding/json"
+)
+
+type SchemaUpsertRequest struct {
+	Name     string          `json:"name" binding:"required"`
+	Schema   json.RawMessage `json:"schema" binding:"required"`
+	Patterns []string        `json:"patterns,omitempty"`
+}
+
+type SchemaListResponse struct {
+	Schemas []*entities.JSONSchema `json:"schemas"`
+}
+
+type SchemaDeleteResponse struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+}
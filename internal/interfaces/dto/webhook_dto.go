@@ -0,0 +1,34 @@
+package dto
+
+import "document-server/internal/domain/entities"
+
+type WebhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+type WebhookCreateResponse struct {
+	*entities.Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookListResponse struct {
+	Webhooks []*entities.Webhook `json:"webhooks"`
+}
+
+type WebhookDeleteResponse struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+}
+
+type WebhookDeliveriesRequest struct {
+	Token  string `form:"token" binding:"required"`
+	Status string `form:"status,omitempty"`
+	Limit  int    `form:"limit,omitempty"`
+	Offset int    `form:"offset,omitempty"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []*entities.WebhookDelivery `json:"deliveries"`
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/services"
+	"document-server/internal/interfaces/dto"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditSvc *services.AuditService
+	authSvc  *services.AuthService
+}
+
+func NewAuditHandler(auditSvc *services.AuditService, authSvc *services.AuthService) *AuditHandler {
+	return &AuditHandler{
+		auditSvc: auditSvc,
+		authSvc:  authSvc,
+	}
+}
+
+// List returns audit events to administrators, identified by the admin token.
+func (h *AuditHandler) List(c *gin.Context) {
+	var req dto.AuditListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	if err := h.authSvc.ValidateAdminToken(c.Request.Context(), req.Token); err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	filter, err := buildAuditFilter(&req)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	events, err := h.auditSvc.List(c.Request.Context(), filter)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, dto.AuditListResponse{Events: events}, nil)
+}
+
+// buildAuditFilter converts the query parameters; from and to are RFC 3339
+// timestamps.
+func buildAuditFilter(req *dto.AuditListRequest) (*entities.AuditFilter, error) {
+	filter := &entities.AuditFilter{
+		Actor:      req.Actor,
+		Action:     req.Action,
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		Outcome:    req.Outcome,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	}
+
+	if req.From != "" {
+		from, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 timestamp")
+		}
+		from = from.UTC()
+		filter.From = &from
+	}
+
+	if req.To != "" {
+		to, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 timestamp")
+		}
+		to = to.UTC()
+		filter.To = &to
+	}
+
+	return filter, nil
+}
@@ -1,34 +1,53 @@
 package handlers
 
 import (
+	"context"
 	"document-server/internal/domain/entities"
 	"document-server/internal/domain/services"
 	"document-server/internal/interfaces/dto"
+	"document-server/pkg/errors"
+	"document-server/pkg/jsonpatch"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// TransferRecorder counts the bytes of the files moving through the API.
+type TransferRecorder interface {
+	FileUploaded(bytes int64)
+	FileDownloaded(bytes int64)
+}
+
 type DocumentHandler struct {
-	documentSvc *services.DocumentService
-	authSvc     *services.AuthService
-	storagePath string
+	documentSvc    *services.DocumentService
+	authSvc        *services.AuthService
+	storagePath    string
+	requireIfMatch bool
+	transfers      TransferRecorder
 }
 
 func NewDocumentHandler(
 	documentSvc *services.DocumentService,
 	authSvc *services.AuthService,
 	storagePath string,
+	requireIfMatch bool,
+	transfers TransferRecorder,
 ) *DocumentHandler {
 	return &DocumentHandler{
-		documentSvc: documentSvc,
-		authSvc:     authSvc,
-		storagePath: storagePath,
+		documentSvc:    documentSvc,
+		authSvc:        authSvc,
+		storagePath:    storagePath,
+		requireIfMatch: requireIfMatch,
+		transfers:      transfers,
 	}
 }
 
@@ -60,34 +79,11 @@ func (h *DocumentHandler) Create(c *gin.Context) {
 	var jsonData json.RawMessage
 
 	if meta.File {
-		file, fileHeader, err := c.Request.FormFile("file")
-		if err != nil {
-			respondWithError(c, http.StatusBadRequest, 400, "file is required when file=true")
-			return
-		}
-		defer file.Close()
-
-		if err := os.MkdirAll(h.storagePath, 0755); err != nil {
-			respondWithError(c, http.StatusInternalServerError, 500, "failed to create storage directory")
-			return
-		}
-
-		fileName := uuid.NewString() + filepath.Ext(fileHeader.Filename)
-		fullPath := filepath.Join(h.storagePath, fileName)
-
-		dst, err := os.Create(fullPath)
-		if err != nil {
-			respondWithError(c, http.StatusInternalServerError, 500, "failed to create file")
+		path, ok := h.saveUploadedFile(c)
+		if !ok {
 			return
 		}
-		defer dst.Close()
-
-		if _, err := io.Copy(dst, file); err != nil {
-			respondWithError(c, http.StatusInternalServerError, 500, "failed to save file")
-			return
-		}
-
-		filePath = &fullPath
+		filePath = &path
 	}
 
 	if jsonStr := c.Request.FormValue("json"); jsonStr != "" {
@@ -95,7 +91,7 @@ func (h *DocumentHandler) Create(c *gin.Context) {
 	}
 
 	doc, err := h.documentSvc.Create(c.Request.Context(),
-		user.ID,
+		user,
 		meta.Name,
 		meta.MIME,
 		meta.File,
@@ -103,8 +99,12 @@ func (h *DocumentHandler) Create(c *gin.Context) {
 		filePath,
 		&jsonData,
 		meta.Grant,
+		meta.Schema,
 	)
 	if err != nil {
+		if filePath != nil {
+			os.Remove(*filePath)
+		}
 		handleServiceError(c, err)
 		return
 	}
@@ -117,9 +117,46 @@ func (h *DocumentHandler) Create(c *gin.Context) {
 		response.File = doc.Name
 	}
 
+	c.Header("ETag", etag(doc))
 	respondWithSuccess(c, nil, response)
 }
 
+// saveUploadedFile stores the "file" form field under the storage path and
+// returns its location. On failure it writes the error response.
+func (h *DocumentHandler) saveUploadedFile(c *gin.Context) (string, bool) {
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, "file is required when file=true")
+		return "", false
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(h.storagePath, 0755); err != nil {
+		respondWithError(c, http.StatusInternalServerError, 500, "failed to create storage directory")
+		return "", false
+	}
+
+	fileName := uuid.NewString() + filepath.Ext(fileHeader.Filename)
+	fullPath := filepath.Join(h.storagePath, fileName)
+
+	dst, err := os.Create(fullPath)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, 500, "failed to create file")
+		return "", false
+	}
+	defer dst.Close()
+
+	written, err := io.Copy(dst, file)
+	if err != nil {
+		os.Remove(fullPath)
+		respondWithError(c, http.StatusInternalServerError, 500, "failed to save file")
+		return "", false
+	}
+	h.transfers.FileUploaded(written)
+
+	return fullPath, true
+}
+
 func (h *DocumentHandler) GetList(c *gin.Context) {
 	var req dto.DocumentListRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
@@ -127,12 +164,60 @@ func (h *DocumentHandler) GetList(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
+	filter, ok := h.buildListFilter(c, &req)
+	if !ok {
+		return
+	}
+
+	docs, err := h.documentSvc.GetList(c.Request.Context(), filter)
 	if err != nil {
 		handleServiceError(c, err)
 		return
 	}
 
+	respondWithSuccess(c, nil, dto.DocumentListResponse{Docs: docs})
+}
+
+func (h *DocumentHandler) Aggregate(c *gin.Context) {
+	var req dto.DocumentAggregateRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	filter, ok := h.buildListFilter(c, &req.DocumentListRequest)
+	if !ok {
+		return
+	}
+
+	metric := req.Metric
+	if metric == "" {
+		metric = entities.AggregateCount
+	}
+
+	buckets, err := h.documentSvc.Aggregate(c.Request.Context(), filter, req.GroupBy, metric, req.Field)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.DocumentAggregateResponse{
+		GroupBy: req.GroupBy,
+		Metric:  metric,
+		Field:   req.Field,
+		Buckets: buckets,
+	})
+}
+
+// buildListFilter authenticates the request and turns list query parameters
+// into a filter. On failure it writes the error response and returns false.
+func (h *DocumentHandler) buildListFilter(c *gin.Context, req *dto.DocumentListRequest) (*entities.DocumentFilter, bool) {
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
+	if err != nil {
+		handleServiceError(c, err)
+		return nil, false
+	}
+
 	ownerID := user.ID
 	requestingUserLogin := user.Login
 
@@ -140,26 +225,51 @@ func (h *DocumentHandler) GetList(c *gin.Context) {
 		targetUser, err := h.authSvc.GetUserByLogin(c.Request.Context(), req.Login)
 		if err != nil {
 			respondWithError(c, http.StatusNotFound, 404, "user not found")
-			return
+			return nil, false
 		}
 		ownerID = targetUser.ID
 	}
 
-	filter := &entities.DocumentFilter{
+	var fields []jsonpatch.Pointer
+	if req.Fields != "" {
+		if fields, err = jsonpatch.ParseFields(req.Fields); err != nil {
+			respondWithError(c, http.StatusBadRequest, 400, err.Error())
+			return nil, false
+		}
+	}
+
+	return &entities.DocumentFilter{
 		OwnerID:             ownerID,
 		RequestingUserLogin: requestingUserLogin,
 		Key:                 req.Key,
 		Value:               req.Value,
+		Mode:                req.Mode,
+		Threshold:           req.Threshold,
+		Fields:              fields,
 		Limit:               req.Limit,
+	}, true
+}
+
+func (h *DocumentHandler) Suggest(c *gin.Context) {
+	var req dto.DocumentSuggestRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
 	}
 
-	docs, err := h.documentSvc.GetList(c.Request.Context(), filter)
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
 	if err != nil {
 		handleServiceError(c, err)
 		return
 	}
 
-	respondWithSuccess(c, nil, dto.DocumentListResponse{Docs: docs})
+	names, err := h.documentSvc.SuggestNames(c.Request.Context(), user, req.Query, req.Limit)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.DocumentSuggestResponse{Names: names})
 }
 
 func (h *DocumentHandler) GetByID(c *gin.Context) {
@@ -181,16 +291,40 @@ func (h *DocumentHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	doc, err := h.documentSvc.GetByID(c.Request.Context(), docID, user.Login)
+	projection, err := parseProjection(c)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	doc, err := h.documentSvc.GetByID(c.Request.Context(), docID, user.Login, projection)
 	if err != nil {
 		handleServiceError(c, err)
 		return
 	}
 
+	c.Header("ETag", etag(doc))
+
+	if projection != nil {
+		var jsonData any
+		if doc.JSONData != nil {
+			if err := json.Unmarshal(*doc.JSONData, &jsonData); err != nil {
+				respondWithError(c, http.StatusInternalServerError, 500, "failed to decode document")
+				return
+			}
+		}
+		respondWithSuccess(c, nil, jsonData)
+		return
+	}
+
 	if doc.IsFile && doc.FilePath != nil {
 		c.Header("Content-type", doc.MIME)
 		c.Header("Content-Disposition", `attachment; filename="`+doc.Name+`"`)
 		c.File(*doc.FilePath)
+		// Size stays negative when nothing was sent, as for HEAD.
+		if sent := c.Writer.Size(); sent > 0 {
+			h.transfers.FileDownloaded(int64(sent))
+		}
 		return
 	}
 
@@ -205,6 +339,88 @@ func (h *DocumentHandler) GetByID(c *gin.Context) {
 	respondWithSuccess(c, nil, doc)
 }
 
+// parseProjection reads the optional ?pointer= (RFC 6901) or ?fields=a.b,c
+// query parameters. It returns nil when neither is present.
+func parseProjection(c *gin.Context) (*entities.JSONProjection, error) {
+	pointer, hasPointer := c.GetQuery("pointer")
+	fields := c.Query("fields")
+
+	switch {
+	case hasPointer && fields != "":
+		return nil, fmt.Errorf("pointer and fields cannot be combined")
+	case hasPointer:
+		path, err := jsonpatch.ParsePointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		return &entities.JSONProjection{Pointer: path}, nil
+	case fields != "":
+		paths, err := jsonpatch.ParseFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		return &entities.JSONProjection{Fields: paths}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (h *DocumentHandler) Patch(c *gin.Context) {
+	docID := c.Param("id")
+	if docID == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "document ID is required")
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	contentType := c.ContentType()
+	if contentType != services.ContentTypeJSONPatch && contentType != services.ContentTypeMergePatch {
+		respondWithError(c, http.StatusUnsupportedMediaType, 415, "content type must be "+
+			services.ContentTypeJSONPatch+" or "+services.ContentTypeMergePatch)
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, "failed to read request body")
+		return
+	}
+
+	doc, err := h.documentSvc.PatchJSON(c.Request.Context(), docID, user, ifMatch, contentType, patch)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(doc))
+
+	var jsonData any
+	if doc.JSONData != nil {
+		if err := json.Unmarshal(*doc.JSONData, &jsonData); err != nil {
+			respondWithError(c, http.StatusInternalServerError, 500, "failed to decode patched document")
+			return
+		}
+	}
+
+	respondWithSuccess(c, nil, jsonData)
+}
+
 func (h *DocumentHandler) Delete(c *gin.Context) {
 	docID := c.Param("id")
 	if docID == "" {
@@ -224,7 +440,12 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	err = h.documentSvc.Delete(c.Request.Context(), docID, user.ID)
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err = h.documentSvc.Delete(c.Request.Context(), docID, user, ifMatch)
 	if err != nil {
 		handleServiceError(c, err)
 		return
@@ -232,3 +453,317 @@ func (h *DocumentHandler) Delete(c *gin.Context) {
 
 	respondWithSuccess(c, dto.DocumentDeleteResponse{ID: docID, Success: true}, nil)
 }
+
+func (h *DocumentHandler) Update(c *gin.Context) {
+	docID := c.Param("id")
+	if docID == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "document ID is required")
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB
+		respondWithError(c, http.StatusBadRequest, 400, "failed to parse multipart form")
+		return
+	}
+
+	var meta dto.DocumentUpdateMeta
+	if metaStr := c.Request.FormValue("meta"); metaStr != "" {
+		if err := json.Unmarshal([]byte(metaStr), &meta); err != nil {
+			respondWithError(c, http.StatusBadRequest, 400, "invalid meta format")
+			return
+		}
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var filePath *string
+	if c.Request.MultipartForm != nil && len(c.Request.MultipartForm.File["file"]) > 0 {
+		path, ok := h.saveUploadedFile(c)
+		if !ok {
+			return
+		}
+		filePath = &path
+	}
+
+	var jsonData *json.RawMessage
+	if jsonStr := c.Request.FormValue("json"); jsonStr != "" {
+		raw := json.RawMessage(jsonStr)
+		jsonData = &raw
+	}
+
+	doc, err := h.documentSvc.Update(c.Request.Context(), docID, user, ifMatch, meta.Name, meta.MIME, meta.Schema, filePath, jsonData)
+	if err != nil {
+		if filePath != nil {
+			os.Remove(*filePath)
+		}
+		handleServiceError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(doc))
+	respondWithSuccess(c, nil, doc)
+}
+
+func (h *DocumentHandler) UpdateAccess(c *gin.Context) {
+	docID := c.Param("id")
+	if docID == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "document ID is required")
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	var req dto.DocumentAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	doc, err := h.documentSvc.UpdateAccess(c.Request.Context(), docID, user, ifMatch, req.Public, req.Grant)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(doc))
+	respondWithSuccess(c, nil, doc)
+}
+
+func (h *DocumentHandler) Lock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, docID string, user *entities.User, req *dto.DocumentLockRequest, ttl time.Duration) (*entities.Document, error) {
+		return h.documentSvc.Lock(ctx, docID, user, ttl)
+	})
+}
+
+func (h *DocumentHandler) RefreshLock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, docID string, user *entities.User, req *dto.DocumentLockRequest, ttl time.Duration) (*entities.Document, error) {
+		return h.documentSvc.RefreshLock(ctx, docID, user, ttl)
+	})
+}
+
+func (h *DocumentHandler) Unlock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, docID string, user *entities.User, req *dto.DocumentLockRequest, ttl time.Duration) (*entities.Document, error) {
+		return h.documentSvc.Unlock(ctx, docID, user, req.Force)
+	})
+}
+
+// changeLock parses a lock request and responds with the resulting lock
+// state.
+func (h *DocumentHandler) changeLock(
+	c *gin.Context,
+	change func(ctx context.Context, docID string, user *entities.User, req *dto.DocumentLockRequest, ttl time.Duration) (*entities.Document, error),
+) {
+	docID := c.Param("id")
+	if docID == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "document ID is required")
+		return
+	}
+
+	var req dto.DocumentLockRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			respondWithError(c, http.StatusBadRequest, 400, "ttl must be a positive duration such as 30m")
+			return
+		}
+		ttl = parsed
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	doc, err := change(c.Request.Context(), docID, user, &req, ttl)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	c.Header("ETag", etag(doc))
+	respondWithSuccess(c, dto.DocumentLockResponse{ID: doc.ID, Lock: doc.Lock}, nil)
+}
+
+// Activity returns the audit trail of a document to its owner.
+func (h *DocumentHandler) Activity(c *gin.Context) {
+	docID := c.Param("id")
+	if docID == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "document ID is required")
+		return
+	}
+
+	var req dto.AuditListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	filter, err := buildAuditFilter(&req)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	events, err := h.documentSvc.Activity(c.Request.Context(), docID, user, filter)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, dto.AuditListResponse{Events: events}, nil)
+}
+
+// Changes returns a page of the change feed for sync clients; since is the
+// sync token returned by the previous page.
+func (h *DocumentHandler) Changes(c *gin.Context) {
+	var req dto.DocumentChangesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), req.Token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	page, err := h.documentSvc.Changes(c.Request.Context(), user, req.Since, req.Limit)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, page)
+}
+
+// ifMatch reads the versions the If-Match header accepts. It returns nil when
+// the header is absent (and not required) or "*". Weak and foreign entity tags
+// never match a strong comparison, so a list of only those yields an empty set
+// and the write fails with 412; only malformed syntax is a 400. On failure it
+// writes the error response.
+func (h *DocumentHandler) ifMatch(c *gin.Context) (entities.VersionMatch, bool) {
+	header := strings.Join(c.Request.Header.Values("If-Match"), ",")
+	if strings.TrimSpace(header) == "" {
+		if h.requireIfMatch {
+			handleServiceError(c, errors.NewPreconditionRequiredError("If-Match header is required"))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	versions, ok := parseIfMatch(header)
+	if !ok {
+		respondWithError(c, http.StatusBadRequest, 400, "invalid If-Match header")
+		return nil, false
+	}
+
+	return versions, true
+}
+
+// parseIfMatch parses an If-Match field value (RFC 9110 §13.1.1): either "*"
+// or a comma separated list of entity tags, each optionally prefixed with W/.
+// It reports false when the value is malformed.
+func parseIfMatch(header string) (entities.VersionMatch, bool) {
+	if strings.Trim(header, " \t") == "*" {
+		return nil, true
+	}
+
+	versions := entities.VersionMatch{}
+	tags := 0
+	rest := header
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			break
+		}
+		if rest[0] == ',' {
+			rest = rest[1:]
+			continue
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, false
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, false
+		}
+		opaque := rest[1 : end+1]
+		for i := 0; i < len(opaque); i++ {
+			if b := opaque[i]; b < 0x21 || b == 0x7f {
+				return nil, false
+			}
+		}
+		tags++
+
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, false
+		}
+
+		if weak {
+			continue
+		}
+		if version, err := strconv.ParseInt(opaque, 10, 64); err == nil && version > 0 && strconv.FormatInt(version, 10) == opaque {
+			versions = append(versions, version)
+		}
+	}
+
+	if tags == 0 {
+		return nil, false
+	}
+
+	return versions, true
+}
+
+func etag(doc *entities.Document) string {
+	return `"` + strconv.FormatInt(doc.Version, 10) + `"`
+}
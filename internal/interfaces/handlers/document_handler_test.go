@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"document-server/internal/domain/entities"
+	"slices"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   entities.VersionMatch
+		ok     bool
+	}{
+		{`*`, nil, true},
+		{` * `, nil, true},
+		{`"3"`, entities.VersionMatch{3}, true},
+		{`"3", "4"`, entities.VersionMatch{3, 4}, true},
+		{`"3","4" ,"5"`, entities.VersionMatch{3, 4, 5}, true},
+		{`, "3",,`, entities.VersionMatch{3}, true},
+		{`W/"3"`, entities.VersionMatch{}, true},
+		{`W/"3", "4"`, entities.VersionMatch{4}, true},
+		{`"abc", "0", "-1", "03"`, entities.VersionMatch{}, true},
+		{`"a,b", "7"`, entities.VersionMatch{7}, true},
+		{`3`, nil, false},
+		{`"3`, nil, false},
+		{`"3" "4"`, nil, false},
+		{`"3", *`, nil, false},
+		{`"a b"`, nil, false},
+		{`w/"3"`, nil, false},
+		{`,`, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseIfMatch(tt.header)
+		if ok != tt.ok {
+			t.Errorf("parseIfMatch(%s) ok = %v, want %v", tt.header, ok, tt.ok)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || !slices.Equal(got, tt.want) {
+			t.Errorf("parseIfMatch(%s) = %#v, want %#v", tt.header, got, tt.want)
+		}
+	}
+}
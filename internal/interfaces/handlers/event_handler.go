@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"document-server/internal/domain/services"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+type EventHandler struct {
+	eventSvc  *services.EventService
+	authSvc   *services.AuthService
+	keepAlive time.Duration
+	// shutdown ends the streams when the server shuts down: it does not
+	// cancel the requests it still serves.
+	shutdown context.Context
+}
+
+func NewEventHandler(shutdown context.Context, eventSvc *services.EventService, authSvc *services.AuthService, keepAlive time.Duration) *EventHandler {
+	if keepAlive <= 0 {
+		keepAlive = 15 * time.Second
+	}
+
+	return &EventHandler{
+		eventSvc:  eventSvc,
+		authSvc:   authSvc,
+		keepAlive: keepAlive,
+		shutdown:  shutdown,
+	}
+}
+
+// Stream sends the document changes visible to the user as Server-Sent
+// Events. The token is a query parameter because EventSource cannot set
+// headers. A client reconnecting with Last-Event-ID gets the events it
+// missed, or a reset event if they are no longer buffered. The token is
+// checked again on every keep-alive, so the stream of a revoked session ends.
+func (h *EventHandler) Stream(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	sub := h.eventSvc.Subscribe(user, lastEventID)
+	defer h.eventSvc.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if sub.Reset {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{}})
+	}
+	for _, event := range sub.Replay {
+		c.Render(-1, sse.Event{Id: event.ID, Event: event.Type, Data: event})
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(h.keepAlive)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-h.shutdown.Done():
+			return false
+		case <-ticker.C:
+			if _, err := h.authSvc.ValidateToken(c.Request.Context(), token); err != nil {
+				return false
+			}
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case event, ok := <-sub.Events:
+			if !ok {
+				return false
+			}
+			c.Render(-1, sse.Event{Id: event.ID, Event: event.Type, Data: event})
+			return true
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/repositories"
+	"document-server/internal/domain/services"
+	"document-server/internal/infrastructure/cache"
+	"document-server/pkg/errors"
+	"document-server/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+type oneSession struct {
+	repositories.SessionRepository
+	session *entities.Session
+}
+
+func (r oneSession) GetByToken(ctx context.Context, token string) (*entities.Session, error) {
+	if token != r.session.Token {
+		return nil, errors.NewNotFoundError("session not found")
+	}
+	return r.session, nil
+}
+
+type oneUser struct {
+	repositories.UserRepository
+	user *entities.User
+}
+
+func (r oneUser) GetByID(ctx context.Context, id string) (*entities.User, error) {
+	if id != r.user.ID {
+		return nil, errors.NewNotFoundError("user not found")
+	}
+	return r.user, nil
+}
+
+func TestEventHandlerStreamContentType(t *testing.T) {
+	user := &entities.User{ID: "user-1", Login: "alice"}
+	session := &entities.Session{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+
+	memory := cache.NewMemoryCache()
+	cacheSvc := services.NewRedisCacheService(memory, services.CacheTTLs{})
+	resolver := services.NewUserResolver(oneUser{user: user}, oneSession{session: session}, cacheSvc)
+	authSvc := services.NewAuthService(nil, nil, resolver, nil, "", time.Hour)
+
+	// A server already shutting down ends the stream after the headers.
+	shutdown, cancel := context.WithCancel(context.Background())
+	cancel()
+	h := NewEventHandler(shutdown, services.NewEventService(memory, 0), authSvc, time.Minute)
+
+	router := gin.New()
+	router.GET("/events", h.Stream)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events?token=token")
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+}
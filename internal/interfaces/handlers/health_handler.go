@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"document-server/internal/domain/services"
+	"document-server/internal/interfaces/dto"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	healthSvc *services.HealthService
+	authSvc   *services.AuthService
+}
+
+func NewHealthHandler(healthSvc *services.HealthService, authSvc *services.AuthService) *HealthHandler {
+	return &HealthHandler{
+		healthSvc: healthSvc,
+		authSvc:   authSvc,
+	}
+}
+
+// Live answers as long as the process serves requests; it checks nothing
+// else, so a dependency outage does not get the server restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": services.HealthStatusOK})
+}
+
+// Ready answers 503 while a required dependency is down or the server is
+// shutting down. Errors are left out; administrators see them in Status.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.healthSvc.Check(c.Request.Context())
+	for _, dep := range report.Dependencies {
+		dep.Error = ""
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Status reports dependencies with their latency and errors, versions and
+// uptime to administrators, identified by the admin token.
+func (h *HealthHandler) Status(c *gin.Context) {
+	var req dto.StatusRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	if err := h.authSvc.ValidateAdminToken(c.Request.Context(), req.Token); err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, h.healthSvc.Status(c.Request.Context()), nil)
+}
+
+// Metrics serves the Prometheus metrics to administrators, identified by the
+// admin token, when they share the port of the API.
+func (h *HealthHandler) Metrics(metrics http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.MetricsRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			respondWithError(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+
+		if err := h.authSvc.ValidateAdminToken(c.Request.Context(), req.Token); err != nil {
+			handleServiceError(c, err)
+			return
+		}
+
+		metrics.ServeHTTP(c.Writer, c.Request)
+	}
+}
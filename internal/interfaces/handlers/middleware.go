@@ -1,13 +1,31 @@
 package handlers
 
 import (
+	"document-server/internal/domain/services"
 	"document-server/internal/interfaces/dto"
 	"document-server/pkg/errors"
+	"document-server/pkg/logger"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds request IDs taken from clients.
+	maxRequestIDLength = 128
+	redacted           = "REDACTED"
+)
+
+// sensitiveParams are the query and path parameters whose values are kept
+// out of the logs.
+var sensitiveParams = []string{"token", "password", "secret"}
+
 func respondWithError(c *gin.Context, httpStatus, errorCode int, message string) {
 	c.JSON(httpStatus, dto.APIResponse{
 		Error: &dto.ErrorResponse{
@@ -17,6 +35,16 @@ func respondWithError(c *gin.Context, httpStatus, errorCode int, message string)
 	})
 }
 
+func respondWithErrorDetails(c *gin.Context, httpStatus, errorCode int, message string, details any) {
+	c.JSON(httpStatus, dto.APIResponse{
+		Error: &dto.ErrorResponse{
+			Code:    errorCode,
+			Text:    message,
+			Details: details,
+		},
+	})
+}
+
 func respondWithSuccess(c *gin.Context, response, data any) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Response: response,
@@ -34,6 +62,18 @@ func handleServiceError(c *gin.Context, err error) {
 		respondWithError(c, http.StatusForbidden, 403, e.Message)
 	case *errors.NotFoundError:
 		respondWithError(c, http.StatusNotFound, 404, e.Message)
+	case *errors.ConflictError:
+		respondWithError(c, http.StatusConflict, 409, e.Message)
+	case *errors.PreconditionFailedError:
+		respondWithError(c, http.StatusPreconditionFailed, 412, e.Message)
+	case *errors.LockedError:
+		respondWithError(c, http.StatusLocked, 423, e.Message)
+	case *errors.PreconditionRequiredError:
+		respondWithError(c, http.StatusPreconditionRequired, 428, e.Message)
+	case *errors.UnprocessableEntityError:
+		respondWithError(c, http.StatusUnprocessableEntity, 422, e.Message)
+	case *errors.ValidationError:
+		respondWithErrorDetails(c, http.StatusUnprocessableEntity, 422, e.Message, e.Details)
 	case *errors.InternalError:
 		respondWithError(c, http.StatusInternalServerError, 500, e.Message)
 	default:
@@ -45,8 +85,9 @@ func CORSMiddleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, X-Request-ID")
+		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Header("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -67,6 +108,110 @@ func HeadToGetMiddleware() gin.HandlerFunc {
 	})
 }
 
+// RequestMetaMiddleware records the client address and user agent in the
+// request context for the audit log.
+func RequestMetaMiddleware() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		ctx := services.WithRequestMeta(c.Request.Context(), services.RequestMeta{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	})
+}
+
+// RequestLogMiddleware tags every request with an ID, taken from the
+// X-Request-ID header or generated, and echoes it in the response. The
+// request context carries a logger with the ID, so everything logged for the
+// request can be found by it. Once the request is handled, one access log
+// line is written, except for requests to skipPaths, such as health probes.
+func RequestLogMiddleware(skipPaths ...string) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		start := time.Now()
+		// Read before HEAD requests are turned into GET ones.
+		method := c.Request.Method
+
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := logger.NewContext(c.Request.Context(), logger.Logger.With(zap.String("request_id", requestID)))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if slices.Contains(skipPaths, c.Request.URL.Path) {
+			return
+		}
+
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", method),
+			zap.String("path", redactedURI(c)),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int64("bytes_in", c.Request.ContentLength),
+			zap.Int("bytes_out", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		log := logger.FromContext(ctx)
+		if status >= http.StatusInternalServerError {
+			log.Error("Request handled", fields...)
+		} else {
+			log.Info("Request handled", fields...)
+		}
+	})
+}
+
+// validRequestID accepts IDs short and plain enough to log as they are.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_.:", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// redactedURI returns the request path and query with the values of
+// sensitive parameters, such as tokens, replaced.
+func redactedURI(c *gin.Context) string {
+	path := c.Request.URL.Path
+	for _, param := range c.Params {
+		if param.Value != "" && slices.Contains(sensitiveParams, param.Key) {
+			path = strings.Replace(path, param.Value, redacted, 1)
+		}
+	}
+
+	query := c.Request.URL.Query()
+	if len(query) == 0 {
+		return path
+	}
+	for key, values := range query {
+		if slices.Contains(sensitiveParams, strings.ToLower(key)) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return path + "?" + query.Encode()
+}
+
 type headResponseWriter struct {
 	gin.ResponseWriter
 }
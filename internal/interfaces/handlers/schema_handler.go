@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"document-server/internal/domain/services"
+	"document-server/internal/interfaces/dto"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SchemaHandler struct {
+	schemaSvc *services.SchemaService
+	authSvc   *services.AuthService
+}
+
+func NewSchemaHandler(schemaSvc *services.SchemaService, authSvc *services.AuthService) *SchemaHandler {
+	return &SchemaHandler{
+		schemaSvc: schemaSvc,
+		authSvc:   authSvc,
+	}
+}
+
+func (h *SchemaHandler) Upsert(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	var req dto.SchemaUpsertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	schema, err := h.schemaSvc.Upsert(c.Request.Context(), user, req.Name, req.Schema, req.Patterns)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, schema)
+}
+
+func (h *SchemaHandler) List(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	schemas, err := h.schemaSvc.List(c.Request.Context(), user)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.SchemaListResponse{Schemas: schemas})
+}
+
+func (h *SchemaHandler) GetByName(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	schema, err := h.schemaSvc.GetByName(c.Request.Context(), user, c.Param("name"))
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, schema)
+}
+
+func (h *SchemaHandler) Delete(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	user, err := h.authSvc.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	name := c.Param("name")
+	if err := h.schemaSvc.Delete(c.Request.Context(), user, name); err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, dto.SchemaDeleteResponse{Name: name, Success: true}, nil)
+}
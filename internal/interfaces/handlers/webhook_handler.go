@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"document-server/internal/domain/entities"
+	"document-server/internal/domain/services"
+	"document-server/internal/interfaces/dto"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	webhookSvc *services.WebhookService
+	authSvc    *services.AuthService
+}
+
+func NewWebhookHandler(webhookSvc *services.WebhookService, authSvc *services.AuthService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookSvc: webhookSvc,
+		authSvc:    authSvc,
+	}
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	var req dto.WebhookCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	owner, err := h.resolveOwner(c, token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	webhook, secret, err := h.webhookSvc.Register(c.Request.Context(), owner, req.URL, req.Events, req.Secret)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.WebhookCreateResponse{Webhook: webhook, Secret: secret})
+}
+
+func (h *WebhookHandler) List(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	owner, err := h.resolveOwner(c, token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	webhooks, err := h.webhookSvc.List(c.Request.Context(), owner)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.WebhookListResponse{Webhooks: webhooks})
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	owner, err := h.resolveOwner(c, token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	webhookID := c.Param("id")
+	if err := h.webhookSvc.Delete(c.Request.Context(), owner, webhookID); err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, dto.WebhookDeleteResponse{ID: webhookID, Success: true}, nil)
+}
+
+func (h *WebhookHandler) Deliveries(c *gin.Context) {
+	var req dto.WebhookDeliveriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	owner, err := h.resolveOwner(c, req.Token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	deliveries, err := h.webhookSvc.Deliveries(c.Request.Context(), owner, c.Param("id"), req.Status, req.Limit, req.Offset)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, dto.WebhookDeliveriesResponse{Deliveries: deliveries})
+}
+
+func (h *WebhookHandler) Replay(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		respondWithError(c, http.StatusBadRequest, 400, "token is required")
+		return
+	}
+
+	owner, err := h.resolveOwner(c, token)
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	delivery, err := h.webhookSvc.Replay(c.Request.Context(), owner, c.Param("id"), c.Param("delivery"))
+	if err != nil {
+		handleServiceError(c, err)
+		return
+	}
+
+	respondWithSuccess(c, nil, delivery)
+}
+
+// resolveOwner returns the user behind token, or nil for the admin token,
+// whose webhooks receive events for every document.
+func (h *WebhookHandler) resolveOwner(c *gin.Context, token string) (*entities.User, error) {
+	if h.authSvc.IsAdminToken(token) {
+		return nil, nil
+	}
+	return h.authSvc.ValidateToken(c.Request.Context(), token)
+}
@@ -0,0 +1,3 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_documents_name_trgm ON documents USING gin(name gin_trgm_ops);
\ No newline at end of file
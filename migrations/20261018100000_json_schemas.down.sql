@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_documents_schema_id;
+ALTER TABLE documents DROP COLUMN IF EXISTS schema_id;
+DROP TABLE IF EXISTS json_schemas;
\ No newline at end of file
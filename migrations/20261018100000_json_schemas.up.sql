@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS json_schemas (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    schema JSONB NOT NULL,
+    patterns TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (owner_id, name)
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS schema_id UUID REFERENCES json_schemas(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_json_schemas_owner_id ON json_schemas(owner_id);
+CREATE INDEX IF NOT EXISTS idx_documents_schema_id ON documents(schema_id);
@@ -0,0 +1,3 @@
+ALTER TABLE documents DROP COLUMN IF EXISTS lock_expires_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS lock_acquired_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS lock_holder;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS lock_holder VARCHAR(255);
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS lock_acquired_at TIMESTAMP;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS lock_expires_at TIMESTAMP;
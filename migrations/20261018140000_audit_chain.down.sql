@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_no_truncate();
+DROP TABLE IF EXISTS audit_checkpoints;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS prev_hash;
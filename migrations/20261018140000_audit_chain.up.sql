@@ -0,0 +1,23 @@
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash BYTEA;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash BYTEA;
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL,
+    hash BYTEA NOT NULL,
+    signature BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_event_id ON audit_checkpoints(event_id);
+
+CREATE OR REPLACE FUNCTION audit_events_no_truncate() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events cannot be truncated';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_no_truncate();
@@ -0,0 +1,22 @@
+-- Change log for sync clients. Rows are appended in the transaction of the
+-- document write, in commit order, and keep the document's access so the
+-- feed can tell who saw the change and who lost access with it.
+CREATE TABLE IF NOT EXISTS document_changes (
+    seq BIGSERIAL PRIMARY KEY,
+    doc_id UUID NOT NULL,
+    op VARCHAR(16) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    owner_id UUID NOT NULL,
+    mime VARCHAR(255) NOT NULL,
+    is_file BOOLEAN NOT NULL,
+    is_public BOOLEAN NOT NULL,
+    "grant" TEXT[],
+    prev_public BOOLEAN NOT NULL,
+    prev_grant TEXT[],
+    version BIGINT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_changes_owner_id ON document_changes(owner_id, seq);
+CREATE INDEX IF NOT EXISTS idx_document_changes_grant ON document_changes USING gin("grant");
+CREATE INDEX IF NOT EXISTS idx_document_changes_prev_grant ON document_changes USING gin(prev_grant);
@@ -0,0 +1,49 @@
+// Package migrations embeds the SQL migrations, so the server knows the
+// schema version it was built for and can apply them itself.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Versions returns the versions of the embedded migrations in order.
+// Migrations are named <version>_<name>.<up|down>.sql, as golang-migrate
+// expects.
+func Versions() ([]uint64, error) {
+	names, err := fs.Glob(FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint64, 0, len(names))
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no version", name)
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version: %w", name, err)
+		}
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// LatestVersion returns the version of the newest migration.
+func LatestVersion() (uint64, error) {
+	versions, err := Versions()
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
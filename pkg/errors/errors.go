@@ -59,3 +59,81 @@ func (e *InternalError) Error() string {
 func NewInternalError(message string) *InternalError {
 	return &InternalError{Message: message}
 }
+
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func NewConflictError(message string) *ConflictError {
+	return &ConflictError{Message: message}
+}
+
+type UnprocessableEntityError struct {
+	Message string
+}
+
+func (e *UnprocessableEntityError) Error() string {
+	return e.Message
+}
+
+func NewUnprocessableEntityError(message string) *UnprocessableEntityError {
+	return &UnprocessableEntityError{Message: message}
+}
+
+type ValidationDetail struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Message string
+	Details []ValidationDetail
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func NewValidationError(message string, details []ValidationDetail) *ValidationError {
+	return &ValidationError{Message: message, Details: details}
+}
+
+type PreconditionFailedError struct {
+	Message string
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return e.Message
+}
+
+func NewPreconditionFailedError(message string) *PreconditionFailedError {
+	return &PreconditionFailedError{Message: message}
+}
+
+type PreconditionRequiredError struct {
+	Message string
+}
+
+func (e *PreconditionRequiredError) Error() string {
+	return e.Message
+}
+
+func NewPreconditionRequiredError(message string) *PreconditionRequiredError {
+	return &PreconditionRequiredError{Message: message}
+}
+
+type LockedError struct {
+	Message string
+}
+
+func (e *LockedError) Error() string {
+	return e.Message
+}
+
+func NewLockedError(message string) *LockedError {
+	return &LockedError{Message: message}
+}
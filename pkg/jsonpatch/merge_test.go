@@ -0,0 +1,39 @@
+package jsonpatch_test
+
+import (
+	"document-server/pkg/jsonpatch"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null deletes member", `{"a":"b","c":"d"}`, `{"a":null}`, `{"c":"d"}`},
+		{"null deletes missing member", `{"a":"b"}`, `{"x":null}`, `{"a":"b"}`},
+		{"nested null deletes", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"array replaced whole", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"object replaces scalar", `{"a":"b"}`, `{"a":{"c":null,"d":1}}`, `{"a":{"d":1}}`},
+		{"non-object patch replaces document", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"scalar patch replaces document", `{"a":"b"}`, `1`, `1`},
+		{"null patch replaces document", `{"a":"b"}`, `null`, `null`},
+		{"object patch on array", `[1]`, `{"a":1}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonpatch.MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("merge patch: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("merge patch = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Operation is a single RFC 6902 JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is an RFC 6902 JSON Patch document.
+type Patch []Operation
+
+func DecodePatch(data []byte) (Patch, error) {
+	var patch Patch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range patch {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d (%s) is missing value", ErrInvalidPatch, i, op.Op)
+			}
+		case "move", "copy":
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d has unknown op %q", ErrInvalidPatch, i, op.Op)
+		}
+	}
+
+	return patch, nil
+}
+
+// Apply applies the patch to doc and returns the resulting document. Either
+// every operation succeeds or doc is left untouched and an error is returned.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range p {
+		root, err = p.applyOne(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func (p Patch) applyOne(root any, op Operation) (any, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	case "remove":
+		return remove(root, path)
+	case "replace":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return replace(root, path, value)
+	case "move":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if isProperPrefix(from, path) {
+			return nil, fmt.Errorf("%w: cannot move %s into its own child %s", ErrInvalidPointer, from, path)
+		}
+		value, err := from.Get(root)
+		if err != nil {
+			return nil, err
+		}
+		if root, err = remove(root, from); err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	case "copy":
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := from.Get(root)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, deepCopy(value))
+	case "test":
+		expected, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := path.Get(root)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(actual, expected) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+func add(root any, path Pointer, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return mutate(root, path, 0, func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			idx, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPointer, path, err)
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("%w: parent of %s is not a container", ErrInvalidPointer, path)
+		}
+	})
+}
+
+func remove(root any, path Pointer) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPointer)
+	}
+
+	return mutate(root, path, 0, func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path)
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPointer, path, err)
+			}
+			return append(node[:idx], node[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path)
+		}
+	})
+}
+
+func replace(root any, path Pointer, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return mutate(root, path, 0, func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path)
+			}
+			node[token] = value
+			return node, nil
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPointer, path, err)
+			}
+			node[idx] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path)
+		}
+	})
+}
+
+// mutate walks to the parent of path and lets edit return the replacement for
+// that container. Containers on the way up are rewritten so that slice
+// reallocations are visible to the caller.
+func mutate(node any, path Pointer, depth int, edit func(container any, token string) (any, error)) (any, error) {
+	token := path[depth]
+	if depth == len(path)-1 {
+		return edit(node, token)
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path[:depth+1])
+		}
+		updated, err := mutate(child, path, depth+1, edit)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []any:
+		idx, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPointer, path[:depth+1], err)
+		}
+		updated, err := mutate(n[idx], path, depth+1, edit)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, path[:depth+1])
+	}
+}
+
+func isProperPrefix(prefix, path Pointer) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether two decoded JSON values are equal in the sense of the
+// RFC 6902 test operation: numbers compare by value, objects ignore key order.
+func Equal(a, b any) bool {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok || !Equal(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !Equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Float).SetString(av.String())
+		y, okB := new(big.Float).SetString(bv.String())
+		if !okA || !okB {
+			return av == bv
+		}
+		return x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = deepCopy(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = deepCopy(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// decode parses a JSON value keeping numbers as json.Number so that large
+// integers survive a round trip unchanged. Empty input decodes to null.
+func decode(data []byte) (any, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: unexpected data after JSON value", ErrInvalidPatch)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,182 @@
+package jsonpatch_test
+
+import (
+	"bytes"
+	"document-server/pkg/jsonpatch"
+	"errors"
+	"testing"
+)
+
+func TestPatchApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{
+			name:  "add escaped keys",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/a~1b","value":1},{"op":"add","path":"/m~0n","value":2}]`,
+			want:  `{"a/b":1,"m~n":2}`,
+		},
+		{
+			name:  "remove escaped key",
+			doc:   `{"a/b":1,"c":2}`,
+			patch: `[{"op":"remove","path":"/a~1b"}]`,
+			want:  `{"c":2}`,
+		},
+		{
+			name:  "add appends at dash",
+			doc:   `{"a":[1,2]}`,
+			patch: `[{"op":"add","path":"/a/-","value":3}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "add inserts at index",
+			doc:   `{"a":[1,3]}`,
+			patch: `[{"op":"add","path":"/a/1","value":2}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "replace dash",
+			doc:   `{"a":[1]}`,
+			patch: `[{"op":"replace","path":"/a/-","value":2}]`,
+			err:   jsonpatch.ErrInvalidPointer,
+		},
+		{
+			name:  "remove dash",
+			doc:   `{"a":[1]}`,
+			patch: `[{"op":"remove","path":"/a/-"}]`,
+			err:   jsonpatch.ErrInvalidPointer,
+		},
+		{
+			name:  "leading zero index",
+			doc:   `{"a":[1,2]}`,
+			patch: `[{"op":"remove","path":"/a/01"}]`,
+			err:   jsonpatch.ErrInvalidPointer,
+		},
+		{
+			name:  "move",
+			doc:   `{"a":{"b":1},"c":{}}`,
+			patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`,
+			want:  `{"a":{},"c":{"d":1}}`,
+		},
+		{
+			name:  "move into own child",
+			doc:   `{"a":{"b":{}}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			err:   jsonpatch.ErrInvalidPointer,
+		},
+		{
+			name:  "move onto itself",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"move","from":"/a","path":"/a"}]`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "copy is deep",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			want:  `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			name:  "test numbers by value",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"test","path":"/a","value":1.0},{"op":"test","path":"/a","value":1e0}]`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "test different numbers",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"test","path":"/a","value":1.5}]`,
+			err:   jsonpatch.ErrTestFailed,
+		},
+		{
+			name:  "test objects ignore key order",
+			doc:   `{"a":{"x":1,"y":[1,{"z":null}]}}`,
+			patch: `[{"op":"test","path":"/a","value":{"y":[1,{"z":null}],"x":1}}]`,
+			want:  `{"a":{"x":1,"y":[1,{"z":null}]}}`,
+		},
+		{
+			name:  "test objects with different members",
+			doc:   `{"a":{"x":1}}`,
+			patch: `[{"op":"test","path":"/a","value":{"x":1,"y":2}}]`,
+			err:   jsonpatch.ErrTestFailed,
+		},
+		{
+			name:  "test string against number",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"test","path":"/a","value":"1"}]`,
+			err:   jsonpatch.ErrTestFailed,
+		},
+		{
+			name:  "large integers survive",
+			doc:   `{"a":12345678901234567890}`,
+			patch: `[{"op":"add","path":"/b","value":1}]`,
+			want:  `{"a":12345678901234567890,"b":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := jsonpatch.DecodePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("decode patch: %v", err)
+			}
+
+			got, err := patch.Apply([]byte(tt.doc))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("apply: %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("apply = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchApplyFailureLeavesDocumentUntouched(t *testing.T) {
+	doc := []byte(`{"a":[1,2],"b":{"c":1}}`)
+	original := bytes.Clone(doc)
+
+	patch, err := jsonpatch.DecodePatch([]byte(`[
+		{"op":"remove","path":"/a/0"},
+		{"op":"add","path":"/b/d","value":2},
+		{"op":"test","path":"/b/c","value":2}
+	]`))
+	if err != nil {
+		t.Fatalf("decode patch: %v", err)
+	}
+
+	got, err := patch.Apply(doc)
+	if !errors.Is(err, jsonpatch.ErrTestFailed) {
+		t.Fatalf("apply: %v, want %v", err, jsonpatch.ErrTestFailed)
+	}
+	if got != nil {
+		t.Errorf("apply returned %s on failure", got)
+	}
+	if !bytes.Equal(doc, original) {
+		t.Errorf("document changed to %s", doc)
+	}
+}
+
+func TestDecodePatchInvalid(t *testing.T) {
+	for _, patch := range []string{
+		`{}`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"test","path":"/a"}]`,
+	} {
+		if _, err := jsonpatch.DecodePatch([]byte(patch)); !errors.Is(err, jsonpatch.ErrInvalidPatch) {
+			t.Errorf("DecodePatch(%s): %v, want %v", patch, err, jsonpatch.ErrInvalidPatch)
+		}
+	}
+}
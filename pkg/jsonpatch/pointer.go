@@ -0,0 +1,100 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch   = errors.New("invalid patch")
+	ErrInvalidPointer = errors.New("invalid pointer")
+	ErrTestFailed     = errors.New("test operation failed")
+)
+
+// Pointer is a parsed RFC 6901 JSON Pointer. The zero value refers to the
+// whole document.
+type Pointer []string
+
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("%w: %q must start with '/'", ErrInvalidPointer, s)
+	}
+
+	parts := strings.Split(s[1:], "/")
+	for i, part := range parts {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(part, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("%w: %q has an invalid escape", ErrInvalidPointer, s)
+		}
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+	}
+
+	return Pointer(parts), nil
+}
+
+func (p Pointer) String() string {
+	var b strings.Builder
+	for _, part := range p {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(part, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+// Get returns the value the pointer refers to inside doc.
+func (p Pointer) Get(doc any) (any, error) {
+	cur := doc
+	for i, token := range p {
+		switch node := cur.(type) {
+		case map[string]any:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, p[:i+1])
+			}
+			cur = v
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPointer, p[:i+1], err)
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPointer, p[:i+1])
+		}
+	}
+	return cur, nil
+}
+
+// arrayIndex parses an array reference token. When appending is true the "-"
+// token and an index equal to the length are accepted and refer to the end of
+// the array.
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if token == "-" {
+		if appending {
+			return length, nil
+		}
+		return 0, errors.New("'-' refers to a nonexistent element")
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	limit := length
+	if appending {
+		limit++
+	}
+	if idx >= limit {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+
+	return idx, nil
+}
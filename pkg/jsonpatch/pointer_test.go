@@ -0,0 +1,45 @@
+package jsonpatch_test
+
+import (
+	"document-server/pkg/jsonpatch"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		in   string
+		want jsonpatch.Pointer
+	}{
+		{"", jsonpatch.Pointer{}},
+		{"/", jsonpatch.Pointer{""}},
+		{"/a/b", jsonpatch.Pointer{"a", "b"}},
+		{"/a~1b", jsonpatch.Pointer{"a/b"}},
+		{"/m~0n", jsonpatch.Pointer{"m~n"}},
+		{"/~01", jsonpatch.Pointer{"~1"}},
+		{"/~10", jsonpatch.Pointer{"/0"}},
+	}
+
+	for _, tt := range tests {
+		got, err := jsonpatch.ParsePointer(tt.in)
+		if err != nil {
+			t.Errorf("ParsePointer(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParsePointer(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if s := got.String(); s != tt.in {
+			t.Errorf("ParsePointer(%q).String() = %q", tt.in, s)
+		}
+	}
+}
+
+func TestParsePointerInvalid(t *testing.T) {
+	for _, in := range []string{"a", "/a~", "/a~2", "/~x"} {
+		if _, err := jsonpatch.ParsePointer(in); !errors.Is(err, jsonpatch.ErrInvalidPointer) {
+			t.Errorf("ParsePointer(%q): %v, want %v", in, err, jsonpatch.ErrInvalidPointer)
+		}
+	}
+}
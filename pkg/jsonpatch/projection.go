@@ -0,0 +1,104 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseFields parses a comma separated list of dot separated field paths,
+// e.g. "a.b,c", into pointers.
+func ParseFields(spec string) ([]Pointer, error) {
+	var paths []Pointer
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		path := Pointer(strings.Split(field, "."))
+		for _, token := range path {
+			if token == "" {
+				return nil, fmt.Errorf("%w: empty segment in field %q", ErrInvalidPointer, field)
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no fields given", ErrInvalidPointer)
+	}
+
+	return paths, nil
+}
+
+// Extract returns the encoded value the pointer refers to inside doc.
+func Extract(doc []byte, path Pointer) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := path.Get(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// Project extracts the given paths from doc and returns an object containing
+// only those paths. Paths missing from doc are left out.
+func Project(doc []byte, paths []Pointer) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]json.RawMessage, len(paths))
+	for i, path := range paths {
+		value, err := path.Get(root)
+		if err != nil {
+			continue
+		}
+		if values[i], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return Assemble(paths, values)
+}
+
+// Assemble builds an object in which every path holds the corresponding value.
+// A nil value means the path did not exist and is skipped.
+func Assemble(paths []Pointer, values []json.RawMessage) ([]byte, error) {
+	if len(paths) != len(values) {
+		return nil, fmt.Errorf("got %d values for %d paths", len(values), len(paths))
+	}
+
+	root := make(map[string]any)
+	for i, path := range paths {
+		if values[i] == nil || len(path) == 0 {
+			continue
+		}
+
+		node := root
+		for _, token := range path[:len(path)-1] {
+			child, ok := node[token].(map[string]any)
+			if !ok {
+				if _, exists := node[token]; exists {
+					node = nil
+					break
+				}
+				child = make(map[string]any)
+				node[token] = child
+			}
+			node = child
+		}
+		if node != nil {
+			node[path[len(path)-1]] = values[i]
+		}
+	}
+
+	return json.Marshal(root)
+}
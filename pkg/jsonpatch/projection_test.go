@@ -0,0 +1,104 @@
+package jsonpatch_test
+
+import (
+	"document-server/pkg/jsonpatch"
+	"errors"
+	"testing"
+)
+
+func mustParseFields(t *testing.T, spec string) []jsonpatch.Pointer {
+	t.Helper()
+
+	paths, err := jsonpatch.ParseFields(spec)
+	if err != nil {
+		t.Fatalf("parse fields %q: %v", spec, err)
+	}
+	return paths
+}
+
+func TestProject(t *testing.T) {
+	const doc = `{"a":{"b":1,"c":[10,{"d":2}]},"e":"x","f":null}`
+
+	tests := []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{"single field", "e", `{"e":"x"}`},
+		{"nested field", "a.b", `{"a":{"b":1}}`},
+		{"null value kept", "f", `{"f":null}`},
+		{"missing field", "z", `{}`},
+		{"missing nested field", "a.z", `{}`},
+		{"path through scalar", "e.z", `{}`},
+		{"missing among present", "z,e", `{"e":"x"}`},
+		{"array index", "a.c.0", `{"a":{"c":{"0":10}}}`},
+		{"object inside array", "a.c.1.d", `{"a":{"c":{"1":{"d":2}}}}`},
+		{"array index out of range", "a.c.2", `{}`},
+		{"array dash", "a.c.-", `{}`},
+		{"siblings merge", "a.b,a.c.1.d", `{"a":{"b":1,"c":{"1":{"d":2}}}}`},
+		{"parent after child", "a.b,a", `{"a":{"b":1,"c":[10,{"d":2}]}}`},
+		{"parent before child", "a,a.b", `{"a":{"b":1,"c":[10,{"d":2}]}}`},
+		{"same field twice", "e,e", `{"e":"x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonpatch.Project([]byte(doc), mustParseFields(t, tt.fields))
+			if err != nil {
+				t.Fatalf("project: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("project %q = %s, want %s", tt.fields, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	const doc = `{"a":{"b":[1,{"c":true}]},"a.b":2}`
+
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "", want: `{"a":{"b":[1,{"c":true}]},"a.b":2}`},
+		{path: "/a/b/1/c", want: `true`},
+		{path: "/a.b", want: `2`},
+		{path: "/a/b/0", want: `1`},
+		{path: "/a/b/2", err: jsonpatch.ErrInvalidPointer},
+		{path: "/a/b/-", err: jsonpatch.ErrInvalidPointer},
+		{path: "/a/z", err: jsonpatch.ErrInvalidPointer},
+		{path: "/a/b/0/c", err: jsonpatch.ErrInvalidPointer},
+	}
+
+	for _, tt := range tests {
+		path, err := jsonpatch.ParsePointer(tt.path)
+		if err != nil {
+			t.Fatalf("parse pointer %q: %v", tt.path, err)
+		}
+
+		got, err := jsonpatch.Extract([]byte(doc), path)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("extract %q: %v, want %v", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("extract %q: %v", tt.path, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("extract %q = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseFieldsInvalid(t *testing.T) {
+	for _, spec := range []string{"", " , ", "a..b", ".a", "a."} {
+		if _, err := jsonpatch.ParseFields(spec); !errors.Is(err, jsonpatch.ErrInvalidPointer) {
+			t.Errorf("ParseFields(%q): %v, want %v", spec, err, jsonpatch.ErrInvalidPointer)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -66,3 +69,31 @@ func Fatal(msg string, fields ...zap.Field) {
 func WithContext(fields ...zap.Field) *zap.Logger {
 	return Logger.With(fields...)
 }
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, which FromContext returns
+// from then on. Requests carry one tagged with their request ID.
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the global one. Within a
+// traced operation it adds the trace and span IDs, so log lines can be
+// matched to the trace.
+func FromContext(ctx context.Context) *zap.Logger {
+	l, ok := ctx.Value(contextKey{}).(*zap.Logger)
+	if !ok {
+		l = Logger
+	}
+
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsValid() {
+		return l
+	}
+
+	return l.With(
+		zap.String("trace_id", spanCtx.TraceID().String()),
+		zap.String("span_id", spanCtx.SpanID().String()),
+	)
+}